@@ -0,0 +1,122 @@
+package showcash
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+func (c *Core) apiPutPassword(wr http.ResponseWriter, req *http.Request) {
+	u := GetSessionFromContext(req)
+	if u == nil {
+		apiUnauthorizedError.write(wr)
+		return
+	}
+
+	payload := struct {
+		CurrentPassword string `json:"current_password"`
+		Password        string `json:"password"`
+	}{}
+	if err := json.NewDecoder(req.Body).Decode(&payload); err != nil {
+		log.Println("apiPutPassword.Decode() failed", err)
+		apiBadJSONError.write(wr)
+		return
+	}
+
+	if err := validatePassword(payload.Password); err != nil {
+		validationResponse(wr, err)
+		return
+	}
+	if !c.dao.checkPassword(u.UserID, payload.CurrentPassword) {
+		apiWrongPasswordError.write(wr)
+		return
+	}
+
+	// Log out everywhere else and revoke API tokens, but keep this session
+	// going
+	if err := c.dao.resetPassword(u.UserID, payload.Password); err != nil {
+		log.Println("apiPutPassword().resetPassword failed", err)
+		apiServerError.write(wr)
+		return
+	}
+	epoch, err := c.dao.getSessionEpoch(u.UserID)
+	if err != nil {
+		log.Println("apiPutPassword().getSessionEpoch failed", err)
+		clearUserCookie(wr)
+	} else {
+		u.SessionEpoch = epoch
+		setUserCookie(wr, *u)
+	}
+	apiOK.write(wr)
+}
+
+func (c *Core) apiPutEmail(wr http.ResponseWriter, req *http.Request) {
+	u := GetSessionFromContext(req)
+	if u == nil {
+		apiUnauthorizedError.write(wr)
+		return
+	}
+
+	payload := struct {
+		EmailAddress string `json:"email_address"`
+		Password     string `json:"password"`
+	}{}
+	if err := json.NewDecoder(req.Body).Decode(&payload); err != nil {
+		log.Println("apiPutEmail.Decode() failed", err)
+		apiBadJSONError.write(wr)
+		return
+	}
+
+	payload.EmailAddress = strings.TrimSpace(payload.EmailAddress)
+	if err := validateEmail(payload.EmailAddress); err != nil {
+		validationResponse(wr, err)
+		return
+	}
+	if !c.dao.checkPassword(u.UserID, payload.Password) {
+		apiWrongPasswordError.write(wr)
+		return
+	}
+	if _, err := c.dao.getUserByEmail(payload.EmailAddress); err == nil {
+		apiConflictError.withCode("email_taken").withMessage("That email address already has an account").write(wr)
+		return
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		log.Println("apiPutEmail().getUserByEmail failed", err)
+		apiServerError.write(wr)
+		return
+	}
+
+	// Nothing changes until the new address is verified
+	token, err := c.issueToken(u.UserID, tokenChangeEmail, payload.EmailAddress, verifyEmailTTL)
+	if err != nil {
+		log.Println("apiPutEmail().issueToken failed", err)
+		apiServerError.write(wr)
+		return
+	}
+	link := fmt.Sprintf("%s/verify?token=%s", c.siteURL, url.QueryEscape(token))
+	if err := c.mailer.Send(payload.EmailAddress, "Confirm your new Showcash email", fmt.Sprintf(
+		"Hi %s,\n\nClick the link below to start using this email address for Showcash:\n\n%s\n\n"+
+			"The link works for %d hours. If you didn't ask for this you can ignore this email.\n",
+		u.Username, link, int(verifyEmailTTL.Hours()),
+	)); err != nil {
+		log.Println("apiPutEmail().Send failed", err)
+		apiServerError.write(wr)
+		return
+	}
+
+	// Give the current address a heads up in case it wasn't them
+	if current, err := c.dao.getEmailAddress(u.UserID); err == nil {
+		if err := c.mailer.Send(current, "Your Showcash email is changing", fmt.Sprintf(
+			"Hi %s,\n\nSomeone asked to change the email on your Showcash account. "+
+				"If this wasn't you, reset your password straight away.\n",
+			u.Username,
+		)); err != nil {
+			log.Println("apiPutEmail().Send notice failed", err)
+		}
+	}
+	apiOK.withMessage("Check your new email address for a link to confirm it").write(wr)
+}
@@ -0,0 +1,99 @@
+package showcash
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestCore_HandlerChangePassword(t *testing.T) {
+	_, srv, nick := newTestServer(t)
+	defer srv.Close()
+
+	tests := []struct {
+		name     string
+		current  string
+		password string
+		want     int
+		wantCode string
+	}{
+		{"wrong password", "wrong", "battery staple", http.StatusForbidden, "bad_credentials"},
+		{"weak password", testPassword, "short", http.StatusBadRequest, "invalid_fields"},
+		{"changed", testPassword, "battery staple", http.StatusOK, "ok"},
+		{"old password is gone", testPassword, "something else", http.StatusForbidden, "bad_credentials"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := apiSimpleResponse{}
+			body := map[string]string{"current_password": tt.current, "password": tt.password}
+			if got := nick.do(http.MethodPut, "/api/profile/password", body, &resp); got != tt.want || resp.Code != tt.wantCode {
+				t.Errorf("changing password = %d %+v, want %d %s", got, resp, tt.want, tt.wantCode)
+			}
+		})
+	}
+	if got := nick.do(http.MethodGet, "/api/profile", nil, nil); got != http.StatusOK {
+		t.Errorf("the session that changed the password = %d", got)
+	}
+}
+
+func TestCore_HandlerChangeEmail(t *testing.T) {
+	mail := &testMailer{}
+	store, srv, nick := newTestServer(t, WithMailer(mail))
+	defer srv.Close()
+	user := nick.user
+	newTestUser(t, store, "Kim")
+
+	tests := []struct {
+		name     string
+		email    string
+		password string
+		want     int
+		wantCode string
+	}{
+		{"wrong password", "nicholas@example.com", "wrong", http.StatusForbidden, "bad_credentials"},
+		{"not an email", "nicholas", testPassword, http.StatusBadRequest, "invalid_fields"},
+		{"taken", "KIM@example.com", testPassword, http.StatusConflict, "email_taken"},
+		{"free", "nicholas@example.com", testPassword, http.StatusOK, "ok"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := apiSimpleResponse{}
+			body := map[string]string{"email_address": tt.email, "password": tt.password}
+			if got := nick.do(http.MethodPut, "/api/profile/email", body, &resp); got != tt.want || resp.Code != tt.wantCode {
+				t.Errorf("changing email = %d %+v, want %d %s", got, resp, tt.want, tt.wantCode)
+			}
+		})
+	}
+
+	// Nothing changes until the new address is confirmed
+	if email, _ := store.getEmailAddress(user.UserID); email != "nick@example.com" {
+		t.Errorf("email changed to %s before it was confirmed", email)
+	}
+	if len(mail.sent["nick@example.com"]) != 1 {
+		t.Errorf("the old address got %d emails, want a heads up", len(mail.sent["nick@example.com"]))
+	}
+	token := mail.token("nicholas@example.com")
+	if token == "" {
+		t.Fatal("no confirmation email")
+	}
+	if got := nick.do(http.MethodPost, "/auth/verify", map[string]string{"token": token}, nil); got != http.StatusOK {
+		t.Fatalf("confirming the new email = %d", got)
+	}
+	if email, _ := store.getEmailAddress(user.UserID); email != "nicholas@example.com" || !store.isEmailVerified(user.UserID) {
+		t.Errorf("after confirming email = %s, verified %v", email, store.isEmailVerified(user.UserID))
+	}
+	resp := apiSimpleResponse{}
+	if got := nick.do(http.MethodPost, "/auth/verify", map[string]string{"token": token}, &resp); got != http.StatusBadRequest || resp.Code != "expired" {
+		t.Errorf("confirming twice = %d %+v", got, resp)
+	}
+
+	// Someone else can take the address while the link sits in an inbox
+	if got := nick.do(http.MethodPut, "/api/profile/email", map[string]string{"email_address": "shared@example.com", "password": testPassword}, nil); got != http.StatusOK {
+		t.Fatalf("changing email again = %d", got)
+	}
+	if _, err := store.createUser(User{Username: "Lee", EmailAddress: "shared@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := nick.do(http.MethodPost, "/auth/verify", map[string]string{"token": mail.token("shared@example.com")}, &resp); got != http.StatusConflict || resp.Code != "email_taken" {
+		t.Errorf("confirming an address taken since = %d %+v", got, resp)
+	}
+}
@@ -0,0 +1,118 @@
+package showcash
+
+// acMatcher is an Aho-Corasick automaton over bytes so we can test a
+// string against every filter rule in a single pass
+type acMatcher struct {
+	root     [256]int32
+	children [][]acEdge
+	fail     []int32
+	dict     []int32 // nearest suffix node that ends a pattern
+	pattern  []int32 // index of the pattern ending at this node or -1
+	depth    []int32
+}
+
+type acEdge struct {
+	b  byte
+	to int32
+}
+
+func newACMatcher(patterns []string) *acMatcher {
+	m := &acMatcher{}
+	m.addNode(0)
+	for i := range m.root {
+		m.root[i] = -1
+	}
+
+	for i, p := range patterns {
+		node := int32(0)
+		for j := 0; j < len(p); j++ {
+			next := m.child(node, p[j])
+			if next < 0 {
+				next = m.addNode(m.depth[node] + 1)
+				m.setChild(node, p[j], next)
+			}
+			node = next
+		}
+		if node != 0 && m.pattern[node] < 0 {
+			m.pattern[node] = int32(i)
+		}
+	}
+
+	// Breadth first so every fail link points somewhere already linked
+	queue := make([]int32, 0, len(m.fail))
+	for b := range m.root {
+		if n := m.root[b]; n > 0 {
+			queue = append(queue, n)
+		}
+	}
+	for len(queue) > 0 {
+		u := queue[0]
+		queue = queue[1:]
+		for _, e := range m.children[u] {
+			f := m.fail[u]
+			for f != 0 && m.child(f, e.b) < 0 {
+				f = m.fail[f]
+			}
+			if n := m.child(f, e.b); n >= 0 && n != e.to {
+				m.fail[e.to] = n
+			}
+			if fl := m.fail[e.to]; m.pattern[fl] >= 0 {
+				m.dict[e.to] = fl
+			} else {
+				m.dict[e.to] = m.dict[fl]
+			}
+			queue = append(queue, e.to)
+		}
+	}
+	return m
+}
+
+func (m *acMatcher) addNode(depth int32) int32 {
+	m.children = append(m.children, nil)
+	m.fail = append(m.fail, 0)
+	m.dict = append(m.dict, 0)
+	m.pattern = append(m.pattern, -1)
+	m.depth = append(m.depth, depth)
+	return int32(len(m.fail) - 1)
+}
+
+func (m *acMatcher) child(node int32, b byte) int32 {
+	if node == 0 {
+		return m.root[b]
+	}
+	for _, e := range m.children[node] {
+		if e.b == b {
+			return e.to
+		}
+	}
+	return -1
+}
+
+func (m *acMatcher) setChild(node int32, b byte, to int32) {
+	if node == 0 {
+		m.root[b] = to
+		return
+	}
+	m.children[node] = append(m.children[node], acEdge{b, to})
+}
+
+// find calls fn for every pattern occurrence in s with the pattern index
+// and the byte offsets of the match. Returning false from fn stops the scan.
+func (m *acMatcher) find(s string, fn func(pattern, start, end int) bool) {
+	node := int32(0)
+	for i := 0; i < len(s); i++ {
+		for node != 0 && m.child(node, s[i]) < 0 {
+			node = m.fail[node]
+		}
+		if n := m.child(node, s[i]); n >= 0 {
+			node = n
+		}
+		for o := node; o != 0; o = m.dict[o] {
+			if p := m.pattern[o]; p >= 0 {
+				if !fn(int(p), i+1-int(m.depth[o]), i+1) {
+					return
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package showcash
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gofrs/uuid"
+	"github.com/gorilla/mux"
+)
+
+// Scopes an API token can be given. Routes that don't name a scope only
+// work with the browser session.
+const (
+	scopePostsWrite    = "posts:write"
+	scopeCommentsWrite = "comments:write"
+	scopeProfileRead   = "profile:read"
+	scopeProfileWrite  = "profile:write"
+)
+
+var knownScopes = map[string]bool{
+	scopePostsWrite:    true,
+	scopeCommentsWrite: true,
+	scopeProfileRead:   true,
+	scopeProfileWrite:  true,
+}
+
+const (
+	apiTokenPrefix = "sc_"
+	maxTokenName   = 64
+)
+
+// bearerToken pulls a token out of the Authorization header
+func bearerToken(req *http.Request) (string, bool) {
+	auth := req.Header.Get("Authorization")
+	if len(auth) < 7 || !strings.EqualFold(auth[:7], "Bearer ") {
+		return "", false
+	}
+	return strings.TrimSpace(auth[7:]), true
+}
+
+// tokenUser checks a bearer token and that it has every scope asked for
+func (c *Core) tokenUser(token string, scopes []string) (*User, error) {
+	if !strings.HasPrefix(token, apiTokenPrefix) {
+		return nil, errNotAuthorized
+	}
+	t, u, err := c.dao.useAPIToken(hashToken(token))
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Println("tokenUser().useAPIToken failed", err)
+		}
+		return nil, errNotAuthorized
+	}
+	for _, want := range scopes {
+		if !hasScope(t.Scopes, want) {
+			return nil, errMissingScope
+		}
+	}
+	return &u, nil
+}
+
+var errMissingScope = errors.New("token is missing a scope")
+
+func hasScope(scopes []string, want string) bool {
+	for _, s := range scopes {
+		if s == want {
+			return true
+		}
+	}
+	return false
+}
+
+// validateAPIToken checks what the user asked for when making a token
+func validateAPIToken(t APIToken) error {
+	fe := fieldErrors{}
+	fe.required("name", t.Name, maxTokenName)
+	if len(t.Scopes) == 0 {
+		fe.add("scopes", "pick at least one scope")
+	}
+	for _, s := range t.Scopes {
+		if !knownScopes[s] {
+			fe.add("scopes", "unknown scope "+s)
+		}
+	}
+	return fe.err()
+}
+
+func (c *Core) apiGetAPITokens(wr http.ResponseWriter, req *http.Request) {
+	u := GetSessionFromContext(req)
+	if u == nil {
+		apiUnauthorizedError.write(wr)
+		return
+	}
+
+	result := c.dao.getAPITokens(u.UserID)
+	if err := json.NewEncoder(wr).Encode(result); err != nil {
+		log.Printf("Error Encoding JSON: %s", err)
+	}
+}
+
+func (c *Core) apiPostAPIToken(wr http.ResponseWriter, req *http.Request) {
+	u := GetSessionFromContext(req)
+	if u == nil {
+		apiUnauthorizedError.write(wr)
+		return
+	}
+
+	t := APIToken{}
+	if err := json.NewDecoder(req.Body).Decode(&t); err != nil {
+		log.Println("apiPostAPIToken.Decode() failed", err)
+		apiBadJSONError.write(wr)
+		return
+	}
+	t.Name = strings.TrimSpace(t.Name)
+	if err := validateAPIToken(t); err != nil {
+		validationResponse(wr, err)
+		return
+	}
+	sort.Strings(t.Scopes)
+
+	secret, err := randomString(32)
+	if err != nil {
+		log.Println("apiPostAPIToken().randomString failed", err)
+		apiServerError.write(wr)
+		return
+	}
+	token := apiTokenPrefix + secret
+	t.UserID = u.UserID
+	t.Prefix = token[:len(apiTokenPrefix)+6]
+	result, err := c.dao.createAPIToken(t, hashToken(token))
+	if err != nil {
+		log.Println("apiPostAPIToken().createAPIToken failed", err)
+		apiServerError.write(wr)
+		return
+	}
+
+	// This is the only time anyone sees it
+	result.Token = token
+	wr.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(wr).Encode(result); err != nil {
+		log.Printf("Error Encoding JSON: %s", err)
+	}
+}
+
+func (c *Core) apiDeleteAPIToken(wr http.ResponseWriter, req *http.Request) {
+	u := GetSessionFromContext(req)
+	if u == nil {
+		apiUnauthorizedError.write(wr)
+		return
+	}
+
+	tokenID := uuid.FromStringOrNil(mux.Vars(req)["guid"])
+	if err := c.dao.revokeAPIToken(u.UserID, tokenID); errors.Is(err, sql.ErrNoRows) {
+		apiNotFoundError.write(wr)
+		return
+	} else if err != nil {
+		log.Println("apiDeleteAPIToken().revokeAPIToken failed", err)
+		apiServerError.write(wr)
+		return
+	}
+	apiOK.write(wr)
+}
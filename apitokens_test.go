@@ -0,0 +1,50 @@
+package showcash
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func Test_bearerToken(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+		wantOK bool
+	}{
+		{"", "", false},
+		{"Basic dXNlcjpwYXNz", "", false},
+		{"Bearer sc_abc", "sc_abc", true},
+		{"bearer  sc_abc ", "sc_abc", true},
+		{"Bearer", "", false},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/api/profile", nil)
+		if tt.header != "" {
+			req.Header.Set("Authorization", tt.header)
+		}
+		got, ok := bearerToken(req)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("bearerToken(%q) = %q, %v want %q, %v", tt.header, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func Test_validateAPIToken(t *testing.T) {
+	tests := []struct {
+		name    string
+		token   APIToken
+		wantErr bool
+	}{
+		{"ok", APIToken{Name: "uploader", Scopes: []string{scopePostsWrite, scopeProfileRead}}, false},
+		{"no name", APIToken{Scopes: []string{scopePostsWrite}}, true},
+		{"no scopes", APIToken{Name: "uploader"}, true},
+		{"unknown scope", APIToken{Name: "uploader", Scopes: []string{"admin"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateAPIToken(tt.token); (err != nil) != tt.wantErr {
+				t.Errorf("validateAPIToken() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -4,9 +4,10 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
-	"net/mail"
+	"strings"
 
 	"github.com/gofrs/uuid"
 	"github.com/gorilla/securecookie"
@@ -21,36 +22,80 @@ var sc = securecookie.New(hashKey, blockKey)
 
 func (c *Core) apiPostLogin(wr http.ResponseWriter, req *http.Request) {
 	v := struct {
-		Username string `json:"username,omitempty"`
+		Username string `json:"username,omitempty"` // or email address
 		Password string `json:"password,omitempty"`
 	}{}
 
 	if err := json.NewDecoder(req.Body).Decode(&v); err != nil {
 		log.Println("apiPostLogin.Decode() failed", err)
-		wr.WriteHeader(http.StatusInternalServerError)
+		apiBadJSONError.write(wr)
 		return
 	}
 
-	if !isAlphaNumeric(v.Username) || len(v.Username) > 16 {
-		jsonResponse(wr, "Bad Creds", http.StatusForbidden)
+	// Either a handle or an email address works, anything else can't be
+	// an account so gets the same answer as a wrong password
+	typed := strings.TrimSpace(v.Username)
+	login := strings.ToLower(typed) // the audit ignores case
+	byHandle := isAlphaNumeric(typed) && len(typed) <= maxUsername
+	byEmail := !byHandle && strings.Contains(typed, "@") && validateEmail(typed) == nil
+
+	account, userID := "login:"+login, uuid.Nil
+	if byHandle || byEmail {
+		account, userID = c.loginAccount(typed)
+	}
+	ip := c.clientIP(req)
+	if wait := c.loginThrottle(account, ip); wait > 0 {
+		c.recordLogin(req, login, userID, loginThrottled)
+		throttledResponse(wr, wait)
 		return
 	}
 
-	if user, err := c.dao.getUserByUsernameAndPassword(v.Username, v.Password); err == nil {
-		setUserCookie(wr, user)
-		user.Password = ""
-		user.ShadowBanned = false
-		if err := json.NewEncoder(wr).Encode(user); err != nil {
-			log.Printf("Error Encoding JSON: %s", err)
+	var user User
+	var err error
+	switch {
+	case byHandle:
+		user, err = c.dao.getUserByUsernameAndPassword(typed, v.Password)
+	case byEmail:
+		user, err = c.dao.getUserByEmailAndPassword(typed, v.Password)
+	default:
+		err = sql.ErrNoRows
+	}
+
+	if err == nil {
+		if user.TOTPEnabled {
+			// The code gets its own attempt
+			c.refundLogin(account, ip)
+			c.startTwoFactorLogin(wr, req, login, user)
+			return
 		}
+		c.loginPassed(account, ip)
+		c.completeLogin(wr, req, login, user)
 		return
 	} else if pgErrIs(err, sql.ErrNoRows) {
 		log.Println("No such user")
+		c.recordLogin(req, login, userID, loginBadCreds)
 	} else {
 		log.Println("Got a weird error:", err)
+		c.refundLogin(account, ip)
 	}
 
-	jsonResponse(wr, "Bad Creds", http.StatusForbidden)
+	apiBadCredsError.write(wr)
+}
+
+// completeLogin issues the session cookie once every check has passed
+func (c *Core) completeLogin(wr http.ResponseWriter, req *http.Request, login string, user User) {
+	c.recordLogin(req, login, user.UserID, loginOK)
+	c.finishOAuthLink(wr, req, user.UserID)
+	var err error
+	if user.SessionEpoch, err = c.dao.getSessionEpoch(user.UserID); err != nil {
+		log.Println("completeLogin().getSessionEpoch failed", err)
+	}
+	setUserCookie(wr, user)
+	user.Password = ""
+	user.ShadowBanned = false
+	if err := json.NewEncoder(wr).Encode(user); err != nil {
+		log.Printf("Error Encoding JSON: %s", err)
+	}
 }
 
 func setUserCookie(wr http.ResponseWriter, u User) {
@@ -58,15 +103,18 @@ func setUserCookie(wr http.ResponseWriter, u User) {
 		UserID       uuid.UUID
 		Username     string
 		EmailAddress string
+		SessionEpoch int
 	}{
 		u.UserID,
 		u.Username,
 		u.EmailAddress,
+		u.SessionEpoch,
 	}); err == nil {
 		cookie := &http.Cookie{
-			Name:  "showcash",
-			Value: encoded,
-			Path:  "/",
+			Name:     "showcash",
+			Value:    encoded,
+			Path:     "/",
+			SameSite: http.SameSiteLaxMode,
 		}
 		http.SetCookie(wr, cookie)
 	}
@@ -82,11 +130,30 @@ func clearUserCookie(wr http.ResponseWriter) {
 	http.SetCookie(wr, cookie)
 }
 
-func authMiddleware(h http.HandlerFunc) http.HandlerFunc {
+// authMiddleware only lets through requests with a session cookie that
+// hasn't been revoked by a password reset. When scopes are given an API
+// token with all of them works too.
+func (c *Core) authMiddleware(h http.HandlerFunc, scopes ...string) http.HandlerFunc {
 	return http.HandlerFunc(func(wr http.ResponseWriter, req *http.Request) {
+		if token, ok := bearerToken(req); ok && req.Method != http.MethodOptions {
+			if len(scopes) == 0 {
+				apiForbiddenError.withCode("token_not_allowed").withMessage("API tokens can't be used here").write(wr)
+				return
+			}
+			u, err := c.tokenUser(token, scopes)
+			if errors.Is(err, errMissingScope) {
+				apiForbiddenError.withCode("missing_scope").withMessage("Token needs the " + strings.Join(scopes, ", ") + " scope").write(wr)
+				return
+			} else if err != nil {
+				apiUnauthorizedError.withCode("bad_token").withMessage("That token is invalid or has been revoked").write(wr)
+				return
+			}
+			h.ServeHTTP(wr, RequestWithUserSession(req, *u))
+			return
+		}
 		if cookie, err := req.Cookie("showcash"); err == nil {
 			u := User{}
-			if err = sc.Decode("showcash", cookie.Value, &u); err == nil {
+			if err = sc.Decode("showcash", cookie.Value, &u); err == nil && c.sessionValid(u) {
 				// log.Println("Just saw:", u.Username, u.UserID, u.EmailAddress)
 				h.ServeHTTP(wr, RequestWithUserSession(req, u)) // call ServeHTTP on the original handler
 				return
@@ -96,10 +163,23 @@ func authMiddleware(h http.HandlerFunc) http.HandlerFunc {
 			wr.WriteHeader(http.StatusOK)
 			return
 		}
-		jsonResponse(wr, "Couldnt get the right stuff", http.StatusForbidden)
+		apiUnauthorizedError.write(wr)
 	})
 }
 
+// sessionValid checks the session was issued since the user last reset
+// their password
+func (c *Core) sessionValid(u User) bool {
+	epoch, err := c.dao.getSessionEpoch(u.UserID)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Println("sessionValid().getSessionEpoch failed", err)
+		}
+		return false
+	}
+	return epoch == u.SessionEpoch
+}
+
 // RequestWithUserSession will create a new request and will attach the userSession
 // in the context of the request
 func RequestWithUserSession(req *http.Request, user User) *http.Request {
@@ -129,29 +209,33 @@ func (c *Core) apiPostSignup(wr http.ResponseWriter, req *http.Request) {
 	newUser := User{}
 	if err := json.NewDecoder(req.Body).Decode(&newUser); err != nil {
 		log.Println("apiPostSignup.Decode() failed", err)
-		wr.WriteHeader(http.StatusInternalServerError)
+		apiBadJSONError.write(wr)
 		return
 	}
 
-	// Email check
-	_, err := mail.ParseAddress(newUser.EmailAddress)
-	if err != nil {
-		jsonResponse(wr, "Garbage email", http.StatusBadRequest)
+	// Handle, email and profile checks
+	if err := validateSignup(newUser); err != nil {
+		validationResponse(wr, err)
 		return
 	}
+	c.canonicaliseUser(&newUser)
 
-	// Handle check
-	if !isAlphaNumeric(newUser.Username) || len(newUser.Username) > 16 || !isAllowed(newUser.RealName) {
-		jsonResponse(wr, "Name too short or just rude", http.StatusBadRequest)
+	if c.dao.isUsernameReserved(newUser.Username) {
+		apiAccountExistsError.write(wr)
 		return
 	}
 
 	result, err := c.dao.createUser(newUser)
 	if pgErrIs(err, errNotUnique) {
-		jsonResponse(wr, "Username or email exists... do you have an account?", http.StatusConflict)
+		apiAccountExistsError.write(wr)
 		return
 	} else if err != nil {
-		log.Println("err:", err)
+		log.Println("apiPostSignup().createUser failed", err)
+		apiServerError.write(wr)
+		return
+	}
+	if err := c.sendVerification(result.UserID, result.Username, result.EmailAddress); err != nil {
+		log.Println("apiPostSignup().sendVerification failed", err)
 	}
 
 	// Pass to login
@@ -0,0 +1,203 @@
+package showcash
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif" // decoders for image.Decode()
+	"image/jpeg"
+	_ "image/png"
+	"log"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/gofrs/uuid"
+)
+
+// avatarSizes are the square renditions made for each avatar, largest
+// first. The largest is the one stored in profile_uri.
+var avatarSizes = []int{256, 64}
+
+// maxAvatarPixels stops people sending us enormous images to decode
+const maxAvatarPixels = 40 * 1000 * 1000
+
+var (
+	errNotAnImage = errors.New("not a gif, jpeg or png image")
+	errTooBig     = errors.New("image is too big")
+)
+
+// avatarName matches the file names made by avatarFileName()
+var avatarName = regexp.MustCompile(`^avatar-([0-9a-f-]{36})-[0-9]+\.jpg$`)
+
+func avatarFileName(id uuid.UUID, size int) string {
+	return fmt.Sprintf("avatar-%s-%d.jpg", id, size)
+}
+
+// makeAvatars crops the image to a centred square and renders it at each
+// of avatarSizes as a JPEG
+func makeAvatars(data []byte) ([][]byte, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, errNotAnImage
+	}
+	if cfg.Width*cfg.Height > maxAvatarPixels {
+		return nil, errTooBig
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, errNotAnImage
+	}
+
+	square := squareCrop(img)
+	renditions := make([][]byte, 0, len(avatarSizes))
+	for _, size := range avatarSizes {
+		buf := new(bytes.Buffer)
+		if err := jpeg.Encode(buf, resizeSquare(square, size), &jpeg.Options{Quality: 85}); err != nil {
+			return nil, err
+		}
+		renditions = append(renditions, buf.Bytes())
+	}
+	return renditions, nil
+}
+
+// squareCrop cuts the largest centred square out of img
+func squareCrop(img image.Image) *image.RGBA {
+	b := img.Bounds()
+	side := b.Dx()
+	if b.Dy() < side {
+		side = b.Dy()
+	}
+	x := b.Min.X + (b.Dx()-side)/2
+	y := b.Min.Y + (b.Dy()-side)/2
+
+	dst := image.NewRGBA(image.Rect(0, 0, side, side))
+	// JPEGs have no alpha, so flatten transparent images onto white
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(dst, dst.Bounds(), img, image.Pt(x, y), draw.Over)
+	return dst
+}
+
+// resizeSquare scales a square image to size x size by averaging the
+// source pixels under each destination pixel
+func resizeSquare(src *image.RGBA, size int) *image.RGBA {
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+	side := src.Bounds().Dx()
+	if side == 0 {
+		return dst
+	}
+	for dy := 0; dy < size; dy++ {
+		y0, y1 := dy*side/size, (dy+1)*side/size
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+		for dx := 0; dx < size; dx++ {
+			x0, x1 := dx*side/size, (dx+1)*side/size
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+			var r, g, b, a, n int
+			for y := y0; y < y1; y++ {
+				i := src.PixOffset(x0, y)
+				for x := x0; x < x1; x++ {
+					r += int(src.Pix[i])
+					g += int(src.Pix[i+1])
+					b += int(src.Pix[i+2])
+					a += int(src.Pix[i+3])
+					i += 4
+					n++
+				}
+			}
+			j := dst.PixOffset(dx, dy)
+			dst.Pix[j] = uint8(r / n)
+			dst.Pix[j+1] = uint8(g / n)
+			dst.Pix[j+2] = uint8(b / n)
+			dst.Pix[j+3] = uint8(a / n)
+		}
+	}
+	return dst
+}
+
+// removeAvatar cleans up every rendition of an avatar we made
+func (c *Core) removeAvatar(uri string) {
+	m := avatarName.FindStringSubmatch(filepath.Base(uri))
+	if m == nil {
+		return // Not one of ours
+	}
+	base := strings.TrimSuffix(uri, m[0])
+	id := uuid.FromStringOrNil(m[1])
+	for _, size := range avatarSizes {
+		if err := c.removeImage(base + avatarFileName(id, size)); err != nil {
+			log.Println("removeAvatar() failed", err)
+		}
+	}
+}
+
+func (c *Core) apiPutAvatar(wr http.ResponseWriter, req *http.Request) {
+	u := GetSessionFromContext(req)
+	if u == nil {
+		apiUnauthorizedError.write(wr)
+		return
+	}
+
+	payload := imageUpload{}
+	if err := json.NewDecoder(req.Body).Decode(&payload); err != nil {
+		log.Println("apiPutAvatar.Decode() failed", err)
+		apiBadJSONError.write(wr)
+		return
+	}
+	dec, err := base64.StdEncoding.DecodeString(payload.File)
+	if err != nil {
+		log.Println("apiPutAvatar.DecodeString() failed", err)
+		apiBadRequestError.withMessage("The file isn't valid base64").write(wr)
+		return
+	}
+
+	renditions, err := makeAvatars(dec)
+	if err != nil {
+		apiBadRequestError.withCode("bad_image").withMessage("That image won't work: " + err.Error()).write(wr)
+		return
+	}
+
+	id := uuid.Must(uuid.NewV4())
+	var uris []string
+	for i, size := range avatarSizes {
+		uri, err := c.storeImage(avatarFileName(id, size), renditions[i])
+		if err != nil {
+			log.Println("apiPutAvatar().storeImage failed", err)
+			for _, stored := range uris {
+				c.removeImage(stored)
+			}
+			apiServerError.write(wr)
+			return
+		}
+		uris = append(uris, uri)
+	}
+
+	previous, err := c.dao.setProfileURI(u.UserID, uris[0])
+	if err != nil {
+		log.Println("apiPutAvatar().setProfileURI failed", err)
+		c.removeAvatar(uris[0])
+		apiServerError.write(wr)
+		return
+	}
+	c.removeAvatar(previous)
+
+	if err := json.NewEncoder(wr).Encode(struct {
+		ProfileURI string   `json:"profile_uri"`
+		Sizes      []int    `json:"sizes"`
+		URIs       []string `json:"uris"`
+	}{
+		ProfileURI: uris[0],
+		Sizes:      avatarSizes,
+		URIs:       uris,
+	}); err != nil {
+		log.Printf("Error Encoding JSON: %s", err)
+	}
+}
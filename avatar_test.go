@@ -0,0 +1,51 @@
+package showcash
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+func Test_makeAvatars(t *testing.T) {
+	// A wide image, red in the middle and blue on the sides that get cropped
+	src := image.NewRGBA(image.Rect(0, 0, 300, 100))
+	for y := 0; y < 100; y++ {
+		for x := 0; x < 300; x++ {
+			c := color.RGBA{0, 0, 255, 255}
+			if x >= 100 && x < 200 {
+				c = color.RGBA{255, 0, 0, 255}
+			}
+			src.Set(x, y, c)
+		}
+	}
+	buf := new(bytes.Buffer)
+	if err := png.Encode(buf, src); err != nil {
+		t.Fatal(err)
+	}
+
+	renditions, err := makeAvatars(buf.Bytes())
+	if err != nil {
+		t.Fatal("makeAvatars() failed", err)
+	}
+	if len(renditions) != len(avatarSizes) {
+		t.Fatalf("makeAvatars() made %d renditions, want %d", len(renditions), len(avatarSizes))
+	}
+	for i, data := range renditions {
+		img, format, err := image.Decode(bytes.NewReader(data))
+		if err != nil || format != "jpeg" {
+			t.Fatalf("rendition %d is %q, %v", i, format, err)
+		}
+		if b := img.Bounds(); b.Dx() != avatarSizes[i] || b.Dy() != avatarSizes[i] {
+			t.Errorf("rendition %d is %v, want %dx%[3]d", i, b, avatarSizes[i])
+		}
+		if r, g, b, _ := img.At(0, 0).RGBA(); r>>8 < 200 || g>>8 > 50 || b>>8 > 50 {
+			t.Errorf("rendition %d corner is %d,%d,%d, want the red middle", i, r>>8, g>>8, b>>8)
+		}
+	}
+
+	if _, err := makeAvatars([]byte("not an image")); err != errNotAnImage {
+		t.Errorf("makeAvatars() error = %v, want %v", err, errNotAnImage)
+	}
+}
@@ -1,18 +1,21 @@
 package showcash
 
-import "strings"
+// blacklistWords are matched as whole words unless they say otherwise
+var blacklistWords = []FilterRule{
+	{Pattern: "porn", Category: CategoryAdult, Match: MatchSubstring},
+	{Pattern: "trans", Category: CategoryAdult},
+	{Pattern: "ladyboy", Category: CategoryAdult},
+	{Pattern: "xxx", Category: CategoryAdult, Match: MatchSubstring},
+	{Pattern: "xvideo", Category: CategoryAdult, Match: MatchSubstring},
+	{Pattern: "anal", Category: CategoryAdult},
+	{Pattern: "anus", Category: CategoryAdult},
+	{Pattern: "webcam", Category: CategoryAdult},
+	{Pattern: "cunt", Category: CategorySlur},
+	{Pattern: "nigger", Category: CategorySlur},
+}
 
+// blacklistEntries are known porn domains
 var blacklistEntries []string = []string{
-	"porn",
-	"trans",
-	"ladyboy",
-	"xxx",
-	"xvideo",
-	"anal",
-	"anus",
-	"webcam",
-	"cunt",
-	"nigger",
 	"www.amateurs-gone-wild.com",
 	"guruofporn.com",
 	"www.worldpornlist.com",
@@ -13217,12 +13220,3 @@ var blacklistEntries []string = []string{
 	"zzhdporn.com",
 	"zzitube.com",
 }
-
-func isAllowed(badword string) bool {
-	for i := range blacklistEntries {
-		if strings.Contains(strings.ToLower(badword), blacklistEntries[i]) {
-			return false
-		}
-	}
-	return true
-}
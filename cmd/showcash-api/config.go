@@ -1,6 +1,15 @@
 package main
 
-import "github.com/17twenty/showcash-api/pkg/env"
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/17twenty/showcash-api"
+	"github.com/17twenty/showcash-api/pkg/env"
+	"github.com/17twenty/showcash-api/pkg/oauth"
+)
 
 type databaseConfig struct {
 	User     string
@@ -10,15 +19,105 @@ type databaseConfig struct {
 	Name     string
 }
 
+type mailConfig struct {
+	Host     string
+	Port     int
+	User     string
+	Password string
+	From     string
+	Dir      string // where to drop emails when there's no SMTP host
+}
+
+type oauthConfig struct {
+	ClientID     string
+	ClientSecret string
+}
+
+// oidcConfig is any OpenID Connect provider found through its issuer,
+// handy for self hosted or mock providers
+type oidcConfig struct {
+	Name   string
+	Issuer string
+	oauthConfig
+}
+
 type config struct {
-	UseS3    bool
-	Database databaseConfig
+	UseS3           bool
+	ReportThreshold int
+	FilterRules     string
+	StripAffiliate  bool
+	SiteURL         string
+	LoginFailures   int
+	LoginLockout    time.Duration
+	APIURL          string // where OAuth providers send people back to
+	TrustedProxies  []string
+	Google          oauthConfig
+	GitHub          oauthConfig
+	Instagram       oauthConfig
+	OIDC            oidcConfig
+	CORS            showcash.CORSConfig
+	Server          showcash.ServerConfig
+	Mail            mailConfig
+	Database        databaseConfig
 }
 
 func loadConfig(strict *bool) *config {
 	env.FatalOnMissingEnv = *strict
+	cors := showcash.DefaultCORSConfig()
+	server := showcash.DefaultServerConfig()
 	return &config{
-		UseS3: env.GetAsBool("USES3", false),
+		UseS3:           env.GetAsBool("USES3", false),
+		ReportThreshold: env.GetAsInt("REPORT_THRESHOLD", 5),
+		FilterRules:     env.GetAsString("FILTER_RULES", ""),
+		StripAffiliate:  env.GetAsBool("STRIP_AFFILIATE_TAGS", false),
+		SiteURL:         env.GetAsString("SITE_URL", "http://localhost:8081"),
+		LoginFailures:   env.GetAsInt("LOGIN_MAX_FAILURES", 10),
+		LoginLockout:    time.Duration(env.GetAsInt("LOGIN_LOCKOUT_MINUTES", 15)) * time.Minute,
+		APIURL:          env.GetAsString("API_URL", "http://localhost:8080"),
+		TrustedProxies:  env.GetAsSlice("TRUSTED_PROXIES", nil, ","),
+		Google: oauthConfig{
+			ClientID:     env.GetAsString("OAUTH_GOOGLE_CLIENT_ID", ""),
+			ClientSecret: env.GetAsString("OAUTH_GOOGLE_CLIENT_SECRET", ""),
+		},
+		GitHub: oauthConfig{
+			ClientID:     env.GetAsString("OAUTH_GITHUB_CLIENT_ID", ""),
+			ClientSecret: env.GetAsString("OAUTH_GITHUB_CLIENT_SECRET", ""),
+		},
+		Instagram: oauthConfig{
+			ClientID:     env.GetAsString("OAUTH_INSTAGRAM_CLIENT_ID", ""),
+			ClientSecret: env.GetAsString("OAUTH_INSTAGRAM_CLIENT_SECRET", ""),
+		},
+		OIDC: oidcConfig{
+			Name:   env.GetAsString("OAUTH_OIDC_NAME", "oidc"),
+			Issuer: env.GetAsString("OAUTH_OIDC_ISSUER", ""),
+			oauthConfig: oauthConfig{
+				ClientID:     env.GetAsString("OAUTH_OIDC_CLIENT_ID", ""),
+				ClientSecret: env.GetAsString("OAUTH_OIDC_CLIENT_SECRET", ""),
+			},
+		},
+		CORS: showcash.CORSConfig{
+			AllowedOrigins: env.GetAsSlice("CORS_ORIGINS", cors.AllowedOrigins, ","),
+			AllowedMethods: env.GetAsSlice("CORS_METHODS", cors.AllowedMethods, ","),
+			AllowedHeaders: env.GetAsSlice("CORS_HEADERS", cors.AllowedHeaders, ","),
+			MaxAge:         env.GetAsInt("CORS_MAX_AGE", cors.MaxAge),
+		},
+		Server: showcash.ServerConfig{
+			Addr:            env.GetAsString("LISTEN_ADDR", server.Addr),
+			ReadTimeout:     seconds("READ_TIMEOUT_SECONDS", server.ReadTimeout),
+			WriteTimeout:    seconds("WRITE_TIMEOUT_SECONDS", server.WriteTimeout),
+			IdleTimeout:     seconds("IDLE_TIMEOUT_SECONDS", server.IdleTimeout),
+			ShutdownTimeout: seconds("SHUTDOWN_TIMEOUT_SECONDS", server.ShutdownTimeout),
+			TLSCertFile:     env.GetAsString("TLS_CERT_FILE", ""),
+			TLSKeyFile:      env.GetAsString("TLS_KEY_FILE", ""),
+		},
+		Mail: mailConfig{
+			Host:     env.GetAsString("SMTP_HOST", ""),
+			Port:     env.GetAsInt("SMTP_PORT", 587),
+			User:     env.GetAsString("SMTP_USER", ""),
+			Password: env.GetAsString("SMTP_PASSWORD", ""),
+			From:     env.GetAsString("MAIL_FROM", "Showcash <hello@showcash.io>"),
+			Dir:      env.GetAsString("MAIL_DIR", ""),
+		},
 		Database: databaseConfig{
 			User:     env.GetAsString("DB_USER", "local"),
 			Password: env.GetAsString("DB_PASSWORD", "asecurepassword"),
@@ -28,3 +127,43 @@ func loadConfig(strict *bool) *config {
 		},
 	}
 }
+
+// seconds reads a whole number of seconds
+func seconds(name string, defaultValue time.Duration) time.Duration {
+	return time.Duration(env.GetAsInt(name, int(defaultValue.Seconds()))) * time.Second
+}
+
+// oauthProviders sets up every provider that has a client ID
+func (c *config) oauthProviders() []*oauth.Provider {
+	callback := func(name string) string {
+		return strings.TrimSuffix(c.APIURL, "/") + "/auth/oauth/" + name + "/callback"
+	}
+
+	var providers []*oauth.Provider
+	if c.Google.ClientID != "" {
+		providers = append(providers, oauth.Google(c.Google.ClientID, c.Google.ClientSecret, callback("google")))
+	}
+	if c.GitHub.ClientID != "" {
+		providers = append(providers, oauth.GitHub(c.GitHub.ClientID, c.GitHub.ClientSecret, callback("github")))
+	}
+	if c.Instagram.ClientID != "" {
+		providers = append(providers, oauth.Instagram(c.Instagram.ClientID, c.Instagram.ClientSecret, callback("instagram")))
+	}
+	if c.OIDC.ClientID != "" && c.OIDC.Issuer != "" {
+		p := &oauth.Provider{
+			Name:         c.OIDC.Name,
+			ClientID:     c.OIDC.ClientID,
+			ClientSecret: c.OIDC.ClientSecret,
+			RedirectURL:  callback(c.OIDC.Name),
+			Scopes:       []string{"openid", "email", "profile"},
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := p.Discover(ctx, c.OIDC.Issuer); err != nil {
+			log.Println("Couldn't discover", c.OIDC.Issuer, "- skipping it", err)
+		} else {
+			providers = append(providers, p)
+		}
+	}
+	return providers
+}
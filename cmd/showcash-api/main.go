@@ -9,6 +9,7 @@ import (
 	"path/filepath"
 
 	"github.com/17twenty/showcash-api"
+	"github.com/17twenty/showcash-api/pkg/mailer"
 
 	"github.com/golang-migrate/migrate/v4"
 	_ "github.com/golang-migrate/migrate/v4/database/postgres"
@@ -71,9 +72,38 @@ func main() {
 		log.Fatalln("Couldn't open database -", err)
 	}
 
-	c := showcash.New(
-		dao,
-		config.UseS3,
+	m := mailer.New(
+		config.Mail.Host,
+		config.Mail.Port,
+		config.Mail.User,
+		config.Mail.Password,
+		config.Mail.From,
 	)
-	c.Start()
+	if l, ok := m.(*mailer.Log); ok {
+		l.Dir = config.Mail.Dir
+	}
+
+	opts := []showcash.Option{
+		showcash.WithReportThreshold(config.ReportThreshold),
+		showcash.WithFilterRules(config.FilterRules),
+		showcash.WithAffiliateStripping(config.StripAffiliate),
+		showcash.WithMailer(m),
+		showcash.WithSiteURL(config.SiteURL),
+		showcash.WithLoginLockout(config.LoginFailures, config.LoginLockout),
+		showcash.WithOAuthProviders(config.oauthProviders()...),
+		showcash.WithCORS(config.CORS),
+		showcash.WithTrustedProxies(config.TrustedProxies...),
+	}
+	if config.UseS3 {
+		opts = append(opts, showcash.WithS3())
+	}
+	c := showcash.New(dao, opts...)
+	err = c.Start(config.Server)
+	if err := dao.Close(); err != nil {
+		log.Println("Couldn't close database", err)
+	}
+	if err != nil {
+		log.Fatalln("Server stopped -", err)
+	}
+	log.Println("Bye")
 }
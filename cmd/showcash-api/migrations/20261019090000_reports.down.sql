@@ -0,0 +1,5 @@
+ALTER TABLE showcash.user DROP COLUMN IF EXISTS moderator;
+ALTER TABLE showcash.user DROP COLUMN IF EXISTS hidden;
+ALTER TABLE showcash.comments DROP COLUMN IF EXISTS hidden;
+ALTER TABLE showcash.post DROP COLUMN IF EXISTS hidden;
+DROP TABLE IF EXISTS showcash.report;
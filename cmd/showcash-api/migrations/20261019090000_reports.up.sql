@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS showcash.report (
+    id                  UUID PRIMARY KEY NOT NULL,
+    reporter_id         UUID NOT NULL,
+    -- Extracted
+    target_type         TEXT NOT NULL, -- post, comment or user
+    target_id           UUID NOT NULL,
+    reason              TEXT NOT NULL DEFAULT '',
+    -- End Extracted
+    created_at          TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    UNIQUE(reporter_id, target_type, target_id)
+);
+
+CREATE INDEX IF NOT EXISTS report_target_idx ON showcash.report(target_type, target_id);
+
+-- Content is hidden once it crosses the report threshold
+ALTER TABLE showcash.post ADD COLUMN IF NOT EXISTS hidden BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE showcash.comments ADD COLUMN IF NOT EXISTS hidden BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE showcash.user ADD COLUMN IF NOT EXISTS hidden BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE showcash.user ADD COLUMN IF NOT EXISTS moderator BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS showcash.filter_rule (
+    -- Extracted
+    pattern             TEXT NOT NULL,
+    category            TEXT NOT NULL, -- slur, adult, porn-domain, spam or allow
+    match               TEXT NOT NULL DEFAULT '', -- word, domain or substring
+    -- End Extracted
+    created_at          TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY(pattern, category)
+);
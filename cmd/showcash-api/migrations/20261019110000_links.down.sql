@@ -0,0 +1,4 @@
+ALTER TABLE showcash.user DROP COLUMN IF EXISTS social_3_url;
+ALTER TABLE showcash.user DROP COLUMN IF EXISTS social_2_url;
+ALTER TABLE showcash.user DROP COLUMN IF EXISTS social_1_url;
+ALTER TABLE showcash.item DROP COLUMN IF EXISTS canonical_link;
@@ -0,0 +1,5 @@
+-- Normalised versions of the links people give us
+ALTER TABLE showcash.item ADD COLUMN IF NOT EXISTS canonical_link TEXT NOT NULL DEFAULT '';
+ALTER TABLE showcash.user ADD COLUMN IF NOT EXISTS social_1_url TEXT NOT NULL DEFAULT '';
+ALTER TABLE showcash.user ADD COLUMN IF NOT EXISTS social_2_url TEXT NOT NULL DEFAULT '';
+ALTER TABLE showcash.user ADD COLUMN IF NOT EXISTS social_3_url TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS showcash.follows (
+    follower_id         UUID NOT NULL,
+    followee_id         UUID NOT NULL,
+    created_at          TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY(follower_id, followee_id)
+);
+
+CREATE INDEX IF NOT EXISTS follows_followee_idx ON showcash.follows(followee_id, created_at);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS showcash.post_feed_idx;
+DROP TABLE IF EXISTS showcash.tagfollows;
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS showcash.tagfollows (
+    user_id             UUID NOT NULL,
+    tag_id              BIGINT NOT NULL,
+    created_at          TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY(user_id, tag_id)
+);
+
+CREATE INDEX IF NOT EXISTS post_feed_idx ON showcash.post(user_id, date DESC, id DESC);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS showcash.username_history;
+ALTER TABLE showcash.user DROP COLUMN IF EXISTS username_changed_at;
@@ -0,0 +1,9 @@
+ALTER TABLE showcash.user ADD COLUMN IF NOT EXISTS username_changed_at TIMESTAMP WITH TIME ZONE;
+
+-- Old handles redirect to their owner until they're released
+CREATE TABLE IF NOT EXISTS showcash.username_history (
+    username            TEXT PRIMARY KEY NOT NULL,
+    user_id             UUID NOT NULL,
+    changed_at          TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    reserved_until      TIMESTAMP WITH TIME ZONE NOT NULL
+);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS showcash.user_token;
+ALTER TABLE showcash.user DROP COLUMN IF EXISTS email_verified;
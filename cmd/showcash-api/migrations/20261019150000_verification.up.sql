@@ -0,0 +1,16 @@
+ALTER TABLE showcash.user ADD COLUMN IF NOT EXISTS email_verified BOOLEAN NOT NULL DEFAULT FALSE;
+-- Everyone who signed up before verification existed gets a pass
+UPDATE showcash.user SET email_verified = TRUE;
+
+-- Single use tokens we email out, only the hash of the secret is stored
+CREATE TABLE IF NOT EXISTS showcash.user_token (
+    token_hash          TEXT PRIMARY KEY NOT NULL,
+    user_id             UUID NOT NULL,
+    purpose             TEXT NOT NULL,
+    email_address       TEXT NOT NULL DEFAULT '',
+    expires_at          TIMESTAMP WITH TIME ZONE NOT NULL,
+    used_at             TIMESTAMP WITH TIME ZONE,
+    created_at          TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS user_token_user_idx ON showcash.user_token(user_id, purpose);
@@ -0,0 +1 @@
+ALTER TABLE showcash.user DROP COLUMN IF EXISTS session_epoch;
@@ -0,0 +1,2 @@
+-- Bumped whenever every session for a user should be logged out
+ALTER TABLE showcash.user ADD COLUMN IF NOT EXISTS session_epoch INT NOT NULL DEFAULT 0;
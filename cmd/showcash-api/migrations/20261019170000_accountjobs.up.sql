@@ -0,0 +1,14 @@
+-- Slow jobs run against a whole account, like deleting it
+CREATE TABLE IF NOT EXISTS showcash.account_job (
+    id                  UUID PRIMARY KEY NOT NULL,
+    user_id             UUID NOT NULL,
+    -- Extracted
+    kind                TEXT NOT NULL, -- delete
+    status              TEXT NOT NULL DEFAULT 'pending', -- pending, running, done or failed
+    error               TEXT NOT NULL DEFAULT '',
+    created_at          TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    finished_at         TIMESTAMP WITH TIME ZONE
+    -- End Extracted
+);
+
+CREATE INDEX IF NOT EXISTS account_job_status_idx ON showcash.account_job(status);
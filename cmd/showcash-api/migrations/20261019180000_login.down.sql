@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS showcash.user_lower_username_idx;
+DROP INDEX IF EXISTS showcash.user_lower_email_idx;
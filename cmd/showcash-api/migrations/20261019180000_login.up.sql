@@ -0,0 +1,3 @@
+-- Logins match handles and email addresses ignoring case
+CREATE INDEX IF NOT EXISTS user_lower_username_idx ON showcash.user(lower(username));
+CREATE INDEX IF NOT EXISTS user_lower_email_idx ON showcash.user(lower(email_address));
@@ -0,0 +1,13 @@
+-- Every login attempt, for throttling and for working out what happened
+CREATE TABLE IF NOT EXISTS showcash.login_attempt (
+    id                  BIGSERIAL PRIMARY KEY,
+    login               TEXT NOT NULL, -- lowercased handle or email as typed
+    ip                  TEXT NOT NULL DEFAULT '',
+    user_agent          TEXT NOT NULL DEFAULT '',
+    user_id             UUID, -- only known on success
+    outcome             TEXT NOT NULL, -- ok, bad_creds or throttled
+    created_at          TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS login_attempt_login_idx ON showcash.login_attempt(login, created_at);
+CREATE INDEX IF NOT EXISTS login_attempt_ip_idx ON showcash.login_attempt(ip, created_at);
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS showcash.recovery_code;
+ALTER TABLE showcash.user DROP COLUMN IF EXISTS totp_last_step;
+ALTER TABLE showcash.user DROP COLUMN IF EXISTS totp_enabled;
+ALTER TABLE showcash.user DROP COLUMN IF EXISTS totp_secret;
@@ -0,0 +1,15 @@
+-- TOTP two factor auth, the secret is set at enrolment and only used once
+-- it has been confirmed with a first code
+ALTER TABLE showcash.user ADD COLUMN IF NOT EXISTS totp_secret TEXT NOT NULL DEFAULT '';
+ALTER TABLE showcash.user ADD COLUMN IF NOT EXISTS totp_enabled BOOLEAN NOT NULL DEFAULT FALSE;
+-- Stops a code being replayed within its 30 seconds
+ALTER TABLE showcash.user ADD COLUMN IF NOT EXISTS totp_last_step BIGINT NOT NULL DEFAULT 0;
+
+-- Single use codes for when the phone is lost, only the hash is stored
+CREATE TABLE IF NOT EXISTS showcash.recovery_code (
+    user_id             UUID NOT NULL,
+    code_hash           TEXT NOT NULL,
+    used_at             TIMESTAMP WITH TIME ZONE,
+    created_at          TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY(user_id, code_hash)
+);
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS showcash.oauth_identity;
@@ -0,0 +1,11 @@
+-- Accounts at Google, GitHub etc. that can log in as a user
+CREATE TABLE IF NOT EXISTS showcash.oauth_identity (
+    provider            TEXT NOT NULL,
+    subject             TEXT NOT NULL, -- the provider's ID for the user
+    user_id             UUID NOT NULL,
+    email_address       TEXT NOT NULL DEFAULT '',
+    created_at          TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY(provider, subject)
+);
+
+CREATE INDEX IF NOT EXISTS oauth_identity_user_idx ON showcash.oauth_identity(user_id);
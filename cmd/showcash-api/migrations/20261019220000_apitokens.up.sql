@@ -0,0 +1,16 @@
+-- Personal API tokens for scripts, only the hash of the token is stored
+CREATE TABLE IF NOT EXISTS showcash.api_token (
+    id                  UUID PRIMARY KEY NOT NULL,
+    user_id             UUID NOT NULL,
+    token_hash          TEXT NOT NULL UNIQUE,
+    -- Extracted
+    name                TEXT NOT NULL DEFAULT '',
+    prefix              TEXT NOT NULL DEFAULT '', -- enough to recognise it by
+    scopes              TEXT[] NOT NULL DEFAULT '{}',
+    created_at          TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    last_used_at        TIMESTAMP WITH TIME ZONE,
+    -- End Extracted
+    revoked_at          TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS api_token_user_idx ON showcash.api_token(user_id);
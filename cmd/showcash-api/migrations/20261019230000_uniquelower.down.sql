@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS showcash.user_lower_username_idx;
+DROP INDEX IF EXISTS showcash.user_lower_email_idx;
+CREATE INDEX IF NOT EXISTS user_lower_username_idx ON showcash.user(lower(username));
+CREATE INDEX IF NOT EXISTS user_lower_email_idx ON showcash.user(lower(email_address));
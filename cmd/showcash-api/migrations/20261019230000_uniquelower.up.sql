@@ -0,0 +1,5 @@
+-- Handles and email addresses are unique ignoring case, as logins match them
+DROP INDEX IF EXISTS showcash.user_lower_username_idx;
+DROP INDEX IF EXISTS showcash.user_lower_email_idx;
+CREATE UNIQUE INDEX IF NOT EXISTS user_lower_username_idx ON showcash.user(lower(username));
+CREATE UNIQUE INDEX IF NOT EXISTS user_lower_email_idx ON showcash.user(lower(email_address));
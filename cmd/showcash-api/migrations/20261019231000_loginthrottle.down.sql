@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS showcash.login_attempt_created_at_idx;
+DROP TABLE IF EXISTS showcash.login_throttle;
@@ -0,0 +1,12 @@
+-- Failures per account and per IP, counted before each attempt is checked
+-- so parallel guesses can't all get in ahead of the first failure
+CREATE TABLE IF NOT EXISTS showcash.login_throttle (
+    key                 TEXT PRIMARY KEY, -- user:<id>, login:<as typed> or ip:<address>
+    failures            INTEGER NOT NULL DEFAULT 0,
+    last_failure        TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    previous_failure    TIMESTAMP WITH TIME ZONE -- what a refund puts back
+);
+
+CREATE INDEX IF NOT EXISTS login_throttle_last_failure_idx ON showcash.login_throttle(last_failure);
+-- The audit trail is pruned by age
+CREATE INDEX IF NOT EXISTS login_attempt_created_at_idx ON showcash.login_attempt(created_at);
@@ -0,0 +1,345 @@
+package showcash
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+// FilterCategory says why a rule exists
+type FilterCategory string
+
+// Rule categories - anything in CategoryAllow is never blocked
+const (
+	CategorySlur       FilterCategory = "slur"
+	CategoryAdult      FilterCategory = "adult"
+	CategoryPornDomain FilterCategory = "porn-domain"
+	CategorySpam       FilterCategory = "spam"
+	CategoryAllow      FilterCategory = "allow"
+)
+
+// MatchMode says how a rule pattern is matched against text
+type MatchMode string
+
+// Match modes - an empty mode means MatchDomain for anything with a dot in
+// it and MatchWord for everything else
+const (
+	MatchWord      MatchMode = "word"
+	MatchDomain    MatchMode = "domain"
+	MatchSubstring MatchMode = "substring"
+)
+
+// FilterRule is a single blocked (or allowed) pattern
+type FilterRule struct {
+	Pattern  string         `json:"pattern"`
+	Category FilterCategory `json:"category"`
+	Match    MatchMode      `json:"match"`
+}
+
+// FilterHit is a rule that matched some text
+type FilterHit struct {
+	Rule FilterRule `json:"rule"`
+	Text string     `json:"text"`
+}
+
+// ContentFilter checks user content against the blacklist rules
+// Rules can be swapped at any time with Load()
+type ContentFilter struct {
+	mu      sync.RWMutex
+	rules   []FilterRule
+	allow   map[string]bool
+	domains map[string]int // domain rule pattern to rules index
+	matcher *acMatcher
+}
+
+// contentFilter is the filter used by isAllowed() and friends
+var contentFilter = NewContentFilter(defaultFilterRules())
+
+func isAllowed(s string) bool {
+	return contentFilter.Allowed(s)
+}
+
+// NewContentFilter builds a filter from the given rules
+func NewContentFilter(rules []FilterRule) *ContentFilter {
+	f := &ContentFilter{}
+	f.Load(rules)
+	return f
+}
+
+func defaultFilterRules() []FilterRule {
+	rules := make([]FilterRule, 0, len(blacklistWords)+len(blacklistEntries))
+	rules = append(rules, blacklistWords...)
+	for i := range blacklistEntries {
+		rules = append(rules, FilterRule{
+			Pattern:  blacklistEntries[i],
+			Category: CategoryPornDomain,
+		})
+	}
+	return rules
+}
+
+// Load replaces the rules in use by the filter. A pattern listed more than
+// once keeps its last rule, so the rules file and the filter_rule table can
+// change how a built in pattern matches.
+func (f *ContentFilter) Load(rules []FilterRule) {
+	clean := make([]FilterRule, 0, len(rules))
+	patterns := make([]string, 0, len(rules))
+	seen := map[string]int{}
+	allow := map[string]bool{}
+	domains := map[string]int{}
+	for _, r := range rules {
+		// Some of the imported lists have trailing commas
+		r.Pattern = strings.ToLower(strings.Trim(r.Pattern, ", \t"))
+		if r.Pattern == "" {
+			continue
+		}
+		if r.Category == CategoryAllow {
+			allow[r.Pattern] = true
+			continue
+		}
+		if r.Match == "" {
+			r.Match = MatchWord
+			if strings.Contains(r.Pattern, ".") {
+				r.Match = MatchDomain
+			}
+		}
+		if i, ok := seen[r.Pattern]; ok {
+			if prev := clean[i]; prev.Match != r.Match || prev.Category != r.Category {
+				log.Printf("Filter rule %q is now %s/%s, was %s/%s", r.Pattern, r.Match, r.Category, prev.Match, prev.Category)
+			}
+			clean[i] = r
+			delete(domains, r.Pattern)
+			if r.Match == MatchDomain {
+				domains[r.Pattern] = i
+			}
+			continue
+		}
+		seen[r.Pattern] = len(clean)
+		if r.Match == MatchDomain {
+			domains[r.Pattern] = len(clean)
+		}
+		clean = append(clean, r)
+		patterns = append(patterns, r.Pattern)
+	}
+
+	matcher := newACMatcher(patterns)
+	f.mu.Lock()
+	f.rules, f.allow, f.domains, f.matcher = clean, allow, domains, matcher
+	f.mu.Unlock()
+}
+
+// Len is the number of blocking rules loaded
+func (f *ContentFilter) Len() int {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return len(f.rules)
+}
+
+// Allowed is true when nothing in s matches a rule
+func (f *ContentFilter) Allowed(s string) bool {
+	_, hit := f.Check(s)
+	return !hit
+}
+
+// Check returns the first rule matched by s. The text is normalised first
+// so leetspeak, look-alike characters and s p a c i n g don't get around it.
+func (f *ContentFilter) Check(s string) (FilterHit, bool) {
+	f.mu.RLock()
+	rules, allow, matcher := f.rules, f.allow, f.matcher
+	f.mu.RUnlock()
+
+	for _, text := range normalisedVariants(s) {
+		if hit, found := checkText(text, rules, allow, matcher); found {
+			return hit, true
+		}
+	}
+	return FilterHit{}, false
+}
+
+// CheckDomain checks a host name, and every parent domain of it, against
+// the domain rules only
+func (f *ContentFilter) CheckDomain(host string) (FilterHit, bool) {
+	f.mu.RLock()
+	rules, allow, domains := f.rules, f.allow, f.domains
+	f.mu.RUnlock()
+
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	for d := host; d != ""; {
+		if allow[d] {
+			return FilterHit{}, false
+		}
+		if i, ok := domains[d]; ok {
+			return FilterHit{Rule: rules[i], Text: host}, true
+		}
+		dot := strings.Index(d, ".")
+		if dot < 0 {
+			break
+		}
+		d = d[dot+1:]
+	}
+	return FilterHit{}, false
+}
+
+func checkText(text string, rules []FilterRule, allow map[string]bool, matcher *acMatcher) (FilterHit, bool) {
+	result := FilterHit{}
+	found := false
+	matcher.find(text, func(p, start, end int) bool {
+		r := rules[p]
+		switch r.Match {
+		case MatchWord:
+			if !isWordBoundary(text, start-1) || !isWordBoundary(text, end) {
+				return true
+			}
+		case MatchDomain:
+			if !isHostBoundary(text, start-1) || !isHostBoundary(text, end) {
+				return true
+			}
+		}
+		if allow[enclosingWord(text, start, end)] {
+			return true
+		}
+		result = FilterHit{Rule: r, Text: text[start:end]}
+		found = true
+		return false
+	})
+	return result, found
+}
+
+func isWordByte(b byte) bool {
+	return (b >= 'a' && b <= 'z') || (b >= '0' && b <= '9') || b >= 0x80
+}
+
+func isHostByte(b byte) bool {
+	return isWordByte(b) || b == '-'
+}
+
+func isWordBoundary(s string, i int) bool {
+	return i < 0 || i >= len(s) || !isWordByte(s[i])
+}
+
+func isHostBoundary(s string, i int) bool {
+	return i < 0 || i >= len(s) || !isHostByte(s[i])
+}
+
+// enclosingWord widens a match out to the word it sits in so we can
+// compare it against the allowlist
+func enclosingWord(s string, start, end int) string {
+	for start > 0 && isWordByte(s[start-1]) {
+		start--
+	}
+	for end < len(s) && isWordByte(s[end]) {
+		end++
+	}
+	return s[start:end]
+}
+
+// ReadFilterRules parses rules, one per line, in the form
+//
+//	category pattern [match]
+//
+// Blank lines and lines starting with # are ignored
+func ReadFilterRules(r io.Reader) ([]FilterRule, error) {
+	var rules []FilterRule
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if len(fields) < 2 || len(fields) > 3 {
+			return nil, fmt.Errorf("line %d: expected 'category pattern [match]'", line)
+		}
+		rule := FilterRule{
+			Category: FilterCategory(fields[0]),
+			Pattern:  fields[1],
+		}
+		if len(fields) == 3 {
+			rule.Match = MatchMode(fields[2])
+		}
+		if err := rule.validate(); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, scanner.Err()
+}
+
+// ReadFilterRulesFile is ReadFilterRules for a file on disk
+func ReadFilterRulesFile(path string) ([]FilterRule, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadFilterRules(f)
+}
+
+func (r FilterRule) validate() error {
+	switch r.Category {
+	case CategorySlur, CategoryAdult, CategoryPornDomain, CategorySpam, CategoryAllow:
+	default:
+		return fmt.Errorf("unknown category %q", r.Category)
+	}
+	switch r.Match {
+	case "", MatchWord, MatchDomain, MatchSubstring:
+	default:
+		return fmt.Errorf("unknown match %q", r.Match)
+	}
+	return nil
+}
+
+// reloadContentFilter rebuilds the filter from the built in blacklist, the
+// rules file (if any) and the filter_rule table
+func (c *Core) reloadContentFilter() error {
+	rules := defaultFilterRules()
+	if c.filterRulesFile != "" {
+		fileRules, err := ReadFilterRulesFile(c.filterRulesFile)
+		if err != nil {
+			return err
+		}
+		rules = append(rules, fileRules...)
+	}
+	dbRules, err := c.dao.getFilterRules()
+	if err != nil {
+		return err
+	}
+	for _, r := range dbRules {
+		if err := r.validate(); err != nil {
+			log.Println("Skipping filter rule", r.Pattern, err)
+			continue
+		}
+		rules = append(rules, r)
+	}
+	contentFilter.Load(rules)
+	log.Println("Content filter loaded with", contentFilter.Len(), "rules")
+	return nil
+}
+
+func (c *Core) apiPostReloadFilter(wr http.ResponseWriter, req *http.Request) {
+	u := GetSessionFromContext(req)
+	if u == nil || !c.dao.isModerator(u.UserID) {
+		apiForbiddenError.withMessage("Moderators only").write(wr)
+		return
+	}
+
+	if err := c.reloadContentFilter(); err != nil {
+		log.Println("apiPostReloadFilter().reloadContentFilter failed", err)
+		apiServerError.withMessage("Couldn't reload the filter, keeping the old rules").write(wr)
+		return
+	}
+	if err := json.NewEncoder(wr).Encode(struct {
+		Rules int `json:"rules"`
+	}{
+		Rules: contentFilter.Len(),
+	}); err != nil {
+		log.Printf("Error Encoding JSON: %s", err)
+	}
+}
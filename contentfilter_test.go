@@ -0,0 +1,55 @@
+package showcash
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestContentFilter_Check(t *testing.T) {
+	rules, err := ReadFilterRules(strings.NewReader(`
+# spam and the odd exception
+spam cheap-pills.biz
+spam viagra substring
+allow viagrafalls
+slur cunt
+spam casino
+# a later rule for the same pattern wins
+adult casino substring
+`))
+	if err != nil {
+		t.Fatal("ReadFilterRules() failed", err)
+	}
+	f := NewContentFilter(rules)
+
+	tests := []struct {
+		text     string
+		blocked  bool
+		category FilterCategory
+	}{
+		{text: "Buy at cheap-pills.biz today", blocked: true, category: CategorySpam},
+		{text: "https://shop.cheap-pills.biz/deal", blocked: true, category: CategorySpam},
+		{text: "notcheap-pills.biz", blocked: false},
+		{text: "BuyViagraNow", blocked: true, category: CategorySpam},
+		{text: "Holiday at ViagraFalls", blocked: false},
+		{text: "what a CUNT", blocked: true, category: CategorySlur},
+		{text: "Scunthorpe United", blocked: false},
+		{text: "bestonlinecasinos", blocked: true, category: CategoryAdult},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			hit, blocked := f.Check(tt.text)
+			if blocked != tt.blocked {
+				t.Fatalf("Check(%q) blocked = %v, want %v", tt.text, blocked, tt.blocked)
+			}
+			if blocked && hit.Rule.Category != tt.category {
+				t.Errorf("Check(%q) category = %v, want %v", tt.text, hit.Rule.Category, tt.category)
+			}
+		})
+	}
+}
+
+func TestReadFilterRules_BadCategory(t *testing.T) {
+	if _, err := ReadFilterRules(strings.NewReader("rude bum")); err == nil {
+		t.Error("ReadFilterRules() accepted an unknown category")
+	}
+}
@@ -1,8 +1,6 @@
 package showcash
 
 import (
-	"bytes"
-	"context"
 	"database/sql"
 	"encoding/base64"
 	"encoding/json"
@@ -10,17 +8,17 @@ import (
 	"fmt"
 	"log"
 	"net/http"
-	"os"
 	"path/filepath"
+	"sync"
 	"time"
 
 	"github.com/17twenty/gorillimiter"
 	"github.com/17twenty/showcash-api/pkg/jogly"
+	"github.com/17twenty/showcash-api/pkg/mailer"
+	"github.com/17twenty/showcash-api/pkg/oauth"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 	"github.com/gofrs/uuid"
-	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
 )
 
@@ -28,13 +26,40 @@ var awsSession *session.Session
 
 // Core ...
 type Core struct {
-	dao   DAO
-	useS3 bool
+	dao             Store
+	useS3           bool
+	reportThreshold int
+	filterRulesFile string
+	// stripAffiliateTags removes affiliate and tracking parameters from links
+	stripAffiliateTags bool
+	mailer             mailer.Mailer
+	// siteURL is the frontend, used for links in emails
+	siteURL        string
+	loginPolicy    loginPolicy
+	oauthProviders map[string]*oauth.Provider
+	cors           CORSConfig
+	trustedProxies trustedProxies
+	jobs           *sync.WaitGroup // account jobs still running
 }
 
-// New ...
-func New(dao *DAO, useS3 bool) *Core {
-	if useS3 {
+// New sets up the API on top of dao, a *DAO or a MemStore. Without options uploads stay local,
+// email is only logged and the CORS policy is DefaultCORSConfig().
+func New(dao Store, opts ...Option) *Core {
+	c := &Core{
+		dao:             dao,
+		reportThreshold: 5,
+		mailer:          mailer.New("", 0, "", "", "Showcash <hello@showcash.io>"),
+		siteURL:         "http://localhost:8081",
+		loginPolicy:     newLoginPolicy(10, 15*time.Minute),
+		oauthProviders:  map[string]*oauth.Provider{},
+		cors:            DefaultCORSConfig(),
+		jobs:            &sync.WaitGroup{},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	if c.useS3 {
 		var err error
 		if awsSession, err = session.NewSession(&aws.Config{
 			Region: aws.String("ap-southeast-2")},
@@ -42,10 +67,10 @@ func New(dao *DAO, useS3 bool) *Core {
 			log.Panic("Couldn't create AWS session after requesting", err)
 		}
 	}
-	return &Core{
-		*dao,
-		useS3,
+	if err := c.reloadContentFilter(); err != nil {
+		log.Println("Couldn't load content filter rules, using the defaults", err)
 	}
+	return c
 }
 
 func jsonMiddleware(next http.Handler) http.Handler {
@@ -55,17 +80,37 @@ func jsonMiddleware(next http.Handler) http.Handler {
 	})
 }
 
-// Start ...
-func (c *Core) Start() {
+// Start serves the API until the process is told to stop
+func (c *Core) Start(sc ServerConfig) error {
+	c.resumeAccountJobs()
+	go c.pruneLoginAttempts()
+
+	srv := &http.Server{
+		Addr:         sc.Addr,
+		Handler:      c.Handler(),
+		ReadTimeout:  sc.ReadTimeout,
+		WriteTimeout: sc.WriteTimeout,
+		IdleTimeout:  sc.IdleTimeout,
+	}
+	log.Println("Showcashing on", sc.Addr, "...")
+	return c.serve(srv, sc)
+}
+
+// Handler is the whole API, ready to mount in another server or drive
+// with httptest. Unlike Start it doesn't resume interrupted account jobs.
+func (c *Core) Handler() http.Handler {
 	r := mux.NewRouter()
+	// Even the router's own errors use the usual error body
+	r.NotFoundHandler = http.HandlerFunc(func(wr http.ResponseWriter, req *http.Request) {
+		apiNotFoundError.write(wr)
+	})
+	r.MethodNotAllowedHandler = http.HandlerFunc(func(wr http.ResponseWriter, req *http.Request) {
+		apiMethodNotAllowedError.write(wr)
+	})
 	r.HandleFunc("/healthcheck", func(wr http.ResponseWriter, req *http.Request) {
 		wr.WriteHeader(http.StatusOK)
 	}).Methods(http.MethodGet)
 
-	// Setup Context
-	_, cancel := context.WithCancel(context.Background())
-	defer cancel()
-
 	// Static Endpoints
 	staticRouter := r.PathPrefix("/static/")
 	staticRouter.Handler(http.StripPrefix("/static/", http.FileServer(http.Dir("../../static"))))
@@ -73,8 +118,16 @@ func (c *Core) Start() {
 	// Auth endpoints
 	authRouter := r.PathPrefix("/auth/").Subrouter()
 	authRouter.HandleFunc("/login", c.apiPostLogin).Methods(http.MethodOptions, http.MethodPost)
+	authRouter.HandleFunc("/login/2fa", c.apiPostLoginTwoFactor).Methods(http.MethodOptions, http.MethodPost)
+	authRouter.HandleFunc("/oauth/signup", c.apiPostOAuthSignup).Methods(http.MethodOptions, http.MethodPost)
+	authRouter.HandleFunc("/oauth/{provider}", c.apiGetOAuthStart).Methods(http.MethodGet)
+	authRouter.HandleFunc("/oauth/{provider}/callback", c.apiGetOAuthCallback).Methods(http.MethodGet)
 	authRouter.HandleFunc("/logout", c.apiGetLogout).Methods(http.MethodOptions, http.MethodGet)
 	authRouter.HandleFunc("/register", c.apiPostSignup).Methods(http.MethodOptions, http.MethodPost)
+	authRouter.HandleFunc("/forgot", c.apiPostForgot).Methods(http.MethodOptions, http.MethodPost)
+	authRouter.HandleFunc("/reset", c.apiPostReset).Methods(http.MethodOptions, http.MethodPost)
+	authRouter.HandleFunc("/verify", c.apiPostVerify).Methods(http.MethodOptions, http.MethodPost)
+	authRouter.HandleFunc("/verify/resend", c.authMiddleware(c.apiPostResendVerify)).Methods(http.MethodOptions, http.MethodPost)
 
 	// API endpoints
 	apiRouter := r.PathPrefix("/api/").Subrouter()
@@ -83,15 +136,39 @@ func (c *Core) Start() {
 	apiRouter.HandleFunc("/recent", c.apiGetMostRecent).Methods(http.MethodOptions, http.MethodGet)
 	apiRouter.HandleFunc("/recent/{guid}", c.apiGetUsersMostRecent).Methods(http.MethodOptions, http.MethodGet)
 	apiRouter.HandleFunc("/comments/{guid}", c.apiGetComments).Methods(http.MethodOptions, http.MethodGet)
-	apiRouter.HandleFunc("/comments/{guid}", authMiddleware(c.apiPostComment)).Methods(http.MethodOptions, http.MethodPost)
-	apiRouter.HandleFunc("/me", authMiddleware(c.apiPostCash)).Methods(http.MethodOptions, http.MethodPost)
+	apiRouter.HandleFunc("/comments/{guid}", c.authMiddleware(c.verifiedMiddleware(c.apiPostComment), scopeCommentsWrite)).Methods(http.MethodOptions, http.MethodPost)
+	apiRouter.HandleFunc("/me", c.authMiddleware(c.verifiedMiddleware(c.apiPostCash), scopePostsWrite)).Methods(http.MethodOptions, http.MethodPost)
 	apiRouter.HandleFunc("/remove/{guid}", c.apiDeletePost).Methods(http.MethodOptions, http.MethodDelete)
 	apiRouter.HandleFunc("/claim/{uuid}/{guid}", c.apiClaimPost).Methods(http.MethodOptions, http.MethodPost)
-	apiRouter.HandleFunc("/me/{guid}", authMiddleware(c.apiPutCash)).Methods(http.MethodOptions, http.MethodPut)
+	apiRouter.HandleFunc("/me/{guid}", c.authMiddleware(c.verifiedMiddleware(c.apiPutCash), scopePostsWrite)).Methods(http.MethodOptions, http.MethodPut)
 	apiRouter.HandleFunc("/me/{guid}", c.apiGetCash).Methods(http.MethodOptions, http.MethodGet)
-	apiRouter.HandleFunc("/profile", authMiddleware(c.apiGetMe)).Methods(http.MethodOptions, http.MethodGet)
-	apiRouter.HandleFunc("/profile", authMiddleware(c.apiPutMe)).Methods(http.MethodOptions, http.MethodPut)
+	apiRouter.HandleFunc("/profile", c.authMiddleware(c.apiGetMe, scopeProfileRead)).Methods(http.MethodOptions, http.MethodGet)
+	apiRouter.HandleFunc("/profile", c.authMiddleware(c.apiPutMe, scopeProfileWrite)).Methods(http.MethodOptions, http.MethodPut)
+	apiRouter.HandleFunc("/profile/password", c.authMiddleware(c.apiPutPassword)).Methods(http.MethodOptions, http.MethodPut)
+	apiRouter.HandleFunc("/profile/email", c.authMiddleware(c.apiPutEmail)).Methods(http.MethodOptions, http.MethodPut)
+	apiRouter.HandleFunc("/profile/username", c.authMiddleware(c.apiPutUsername)).Methods(http.MethodOptions, http.MethodPut)
+	apiRouter.HandleFunc("/profile/avatar", c.authMiddleware(c.apiPutAvatar, scopeProfileWrite)).Methods(http.MethodOptions, http.MethodPut)
+	apiRouter.HandleFunc("/profile/2fa", c.authMiddleware(c.apiPostTwoFactor)).Methods(http.MethodOptions, http.MethodPost)
+	apiRouter.HandleFunc("/profile/2fa", c.authMiddleware(c.apiDeleteTwoFactor)).Methods(http.MethodOptions, http.MethodDelete)
+	apiRouter.HandleFunc("/profile/2fa/confirm", c.authMiddleware(c.apiPostTwoFactorConfirm)).Methods(http.MethodOptions, http.MethodPost)
+	apiRouter.HandleFunc("/profile/2fa/recovery", c.authMiddleware(c.apiPostRecoveryCodes)).Methods(http.MethodOptions, http.MethodPost)
+	apiRouter.HandleFunc("/profile/tokens", c.authMiddleware(c.apiGetAPITokens)).Methods(http.MethodOptions, http.MethodGet)
+	apiRouter.HandleFunc("/profile/tokens", c.authMiddleware(c.apiPostAPIToken)).Methods(http.MethodOptions, http.MethodPost)
+	apiRouter.HandleFunc("/profile/tokens/{guid}", c.authMiddleware(c.apiDeleteAPIToken)).Methods(http.MethodOptions, http.MethodDelete)
+	apiRouter.HandleFunc("/profile/export", c.authMiddleware(c.apiGetExport)).Methods(http.MethodOptions, http.MethodGet)
+	apiRouter.HandleFunc("/profile", c.authMiddleware(c.apiDeleteAccount)).Methods(http.MethodOptions, http.MethodDelete)
+	apiRouter.HandleFunc("/profile/jobs/{guid}", c.apiGetAccountJob).Methods(http.MethodOptions, http.MethodGet)
 	apiRouter.HandleFunc("/profile/{handle}", c.apiGetUserProfile).Methods(http.MethodOptions, http.MethodGet)
+	apiRouter.HandleFunc("/profile/{handle}/followers", c.apiGetFollowers).Methods(http.MethodOptions, http.MethodGet)
+	apiRouter.HandleFunc("/profile/{handle}/following", c.apiGetFollowing).Methods(http.MethodOptions, http.MethodGet)
+	apiRouter.HandleFunc("/follow/{handle}", c.authMiddleware(c.apiPostFollow, scopeProfileWrite)).Methods(http.MethodOptions, http.MethodPost)
+	apiRouter.HandleFunc("/follow/{handle}", c.authMiddleware(c.apiDeleteFollow, scopeProfileWrite)).Methods(http.MethodOptions, http.MethodDelete)
+	apiRouter.HandleFunc("/follow/tag/{tag}", c.authMiddleware(c.apiPostFollowTag, scopeProfileWrite)).Methods(http.MethodOptions, http.MethodPost)
+	apiRouter.HandleFunc("/follow/tag/{tag}", c.authMiddleware(c.apiDeleteFollowTag, scopeProfileWrite)).Methods(http.MethodOptions, http.MethodDelete)
+	apiRouter.HandleFunc("/feed", c.authMiddleware(c.apiGetFeed, scopeProfileRead)).Methods(http.MethodOptions, http.MethodGet)
+	apiRouter.HandleFunc("/reports", c.authMiddleware(c.apiPostReport)).Methods(http.MethodOptions, http.MethodPost)
+	apiRouter.HandleFunc("/reports", c.authMiddleware(c.apiGetReports)).Methods(http.MethodOptions, http.MethodGet)
+	apiRouter.HandleFunc("/filter/reload", c.authMiddleware(c.apiPostReloadFilter)).Methods(http.MethodOptions, http.MethodPost)
 
 	// Waitlist goes to Slack
 	apiRouter.HandleFunc("/waitlist", c.apiPostWaitlist).Methods(http.MethodOptions, http.MethodPost)
@@ -100,43 +177,17 @@ func (c *Core) Start() {
 	defaultLimiter := func(next http.Handler) http.Handler {
 		return gorillimiter.Limiter(next, 3, time.Second)
 	}
-	authRouter.Use(jsonMiddleware,
-		defaultLimiter,
-		handlers.CORS(
-			handlers.AllowedMethods([]string{
-				http.MethodGet,
-				http.MethodHead,
-				http.MethodPost,
-				http.MethodPut,
-				http.MethodDelete,
-				http.MethodOptions,
-				http.MethodPatch,
-			}),
-			handlers.AllowedHeaders([]string{"X-Requested-With", "Authorization", "Access-Control-Allow-Methods", "Access-Control-Allow-Origin", "Origin", "Accept", "Content-Type"}),
-			handlers.AllowedOrigins([]string{"http://localhost:8080", "http://localhost:8081", "https://api.showcash.io", "https://showcash.io"}),
-			handlers.AllowCredentials()),
-	)
-
-	apiRouter.Use(jsonMiddleware,
-		defaultLimiter,
-		handlers.CORS(
-			handlers.AllowedMethods([]string{
-				http.MethodGet,
-				http.MethodHead,
-				http.MethodPost,
-				http.MethodPut,
-				http.MethodDelete,
-				http.MethodOptions,
-				http.MethodPatch,
-			}),
-			handlers.AllowedHeaders([]string{"X-Requested-With", "Authorization", "Access-Control-Allow-Methods", "Access-Control-Allow-Origin", "Origin", "Accept", "Content-Type"}),
-			handlers.AllowedOrigins([]string{"http://localhost:8080", "http://localhost:8081", "https://api.showcash.io", "https://showcash.io"}),
-			handlers.AllowCredentials()),
-	)
-
-	http.Handle("/", r)
-	log.Println("Showcashing on port 8080...")
-	http.ListenAndServe(":8080", nil)
+	// Both routers share one CORS policy, and the same origins are trusted
+	// for CSRF
+	for _, router := range []*mux.Router{authRouter, apiRouter} {
+		router.Use(jsonMiddleware,
+			defaultLimiter,
+			c.cors.middleware(),
+			csrfMiddleware(c.cors.originAllowed),
+		)
+	}
+
+	return r
 }
 
 func (c *Core) apiPostRecommend(wr http.ResponseWriter, req *http.Request) {
@@ -147,7 +198,7 @@ func (c *Core) apiPostRecommend(wr http.ResponseWriter, req *http.Request) {
 	}{}
 	if err := json.NewDecoder(req.Body).Decode(&v); err != nil {
 		log.Println("apiPostComment.Decode() failed", err)
-		wr.WriteHeader(http.StatusInternalServerError)
+		apiBadJSONError.write(wr)
 		return
 	}
 
@@ -168,7 +219,7 @@ func (c *Core) apiPostWaitlist(wr http.ResponseWriter, req *http.Request) {
 	u := User{}
 	if err := json.NewDecoder(req.Body).Decode(&u); err != nil {
 		log.Println("apiPostWaitlist.Decode() failed", err)
-		wr.WriteHeader(http.StatusInternalServerError)
+		apiBadJSONError.write(wr)
 		return
 	}
 
@@ -190,26 +241,26 @@ func (c *Core) apiPostWaitlist(wr http.ResponseWriter, req *http.Request) {
 func (c *Core) apiPostComment(wr http.ResponseWriter, req *http.Request) {
 	postID := uuid.FromStringOrNil(mux.Vars(req)["guid"])
 	if postID == uuid.Nil {
-		wr.WriteHeader(http.StatusNotFound)
+		apiNotFoundError.write(wr)
 		return
 	}
 
 	u := GetSessionFromContext(req)
 	if u == nil {
-		wr.WriteHeader(http.StatusNotFound)
+		apiUnauthorizedError.write(wr)
 		return
 	}
 
 	comment := Comment{}
 	if err := json.NewDecoder(req.Body).Decode(&comment); err != nil {
 		log.Println("apiPostComment.Decode() failed", err)
-		wr.WriteHeader(http.StatusInternalServerError)
+		apiBadJSONError.write(wr)
 		return
 	}
 
-	if !isAllowed(comment.Comment) {
+	if err := validateComment(comment); err != nil {
 		log.Println("Bad Comment Posted by", u.Username)
-		wr.WriteHeader(http.StatusInternalServerError)
+		validationResponse(wr, err)
 		return
 	}
 
@@ -218,6 +269,8 @@ func (c *Core) apiPostComment(wr http.ResponseWriter, req *http.Request) {
 	result, err := c.dao.createComment(u.UserID, postID, comment)
 	if err != nil {
 		log.Println("apiPostComment().createComment failed", err)
+		apiServerError.write(wr)
+		return
 	}
 	wr.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(wr).Encode(result); err != nil {
@@ -227,42 +280,81 @@ func (c *Core) apiPostComment(wr http.ResponseWriter, req *http.Request) {
 
 func (c *Core) apiGetMe(wr http.ResponseWriter, req *http.Request) {
 	u := GetSessionFromContext(req)
-	if u != nil {
-		profile, _ := c.dao.getUserProfileByID(u.UserID)
-		if err := json.NewEncoder(wr).Encode(profile); err != nil {
-			log.Printf("Error Encoding JSON: %s", err)
-		}
+	if u == nil {
+		apiUnauthorizedError.write(wr)
+		return
+	}
+	profile, err := c.dao.getUserProfileByID(u.UserID)
+	if errors.Is(err, sql.ErrNoRows) {
+		apiNotFoundError.write(wr)
+		return
+	} else if err != nil {
+		log.Println("apiGetMe().getUserProfileByID failed", err)
+		apiServerError.write(wr)
+		return
+	}
+	if err := json.NewEncoder(wr).Encode(profile); err != nil {
+		log.Printf("Error Encoding JSON: %s", err)
 	}
 }
 func (c *Core) apiPutMe(wr http.ResponseWriter, req *http.Request) {
 	session := GetSessionFromContext(req)
-	if session != nil {
+	if session == nil {
+		apiUnauthorizedError.write(wr)
+		return
+	}
 
-		user := User{}
-		// Get the payload
-		if err := json.NewDecoder(req.Body).Decode(&user); err != nil {
-			log.Println("apiPutMe.Decode() failed", err)
-			wr.WriteHeader(http.StatusInternalServerError)
-			return
-		}
+	user := User{}
+	// Get the payload
+	if err := json.NewDecoder(req.Body).Decode(&user); err != nil {
+		log.Println("apiPutMe.Decode() failed", err)
+		apiBadJSONError.write(wr)
+		return
+	}
+
+	if err := validateProfile(user); err != nil {
+		validationResponse(wr, err)
+		return
+	}
 
-		// Verify we only modify the logged in user
-		user.UserID = session.UserID
+	// Verify we only modify the logged in user
+	user.UserID = session.UserID
+	c.canonicaliseUser(&user)
 
-		current, _ := c.dao.updateUser(user)
-		if err := json.NewEncoder(wr).Encode(current); err != nil {
-			log.Printf("Error Encoding JSON: %s", err)
+	current, err := c.dao.updateUser(user)
+	if err != nil {
+		log.Println("apiPutMe().updateUser failed", err)
+		apiServerError.write(wr)
+		return
+	}
+	if user.Interests != nil {
+		if current.Interests, err = c.dao.setInterests(user.UserID, user.Interests); err != nil {
+			log.Println("apiPutMe().setInterests failed", err)
+			apiServerError.write(wr)
+			return
 		}
 	}
+	if err := json.NewEncoder(wr).Encode(current); err != nil {
+		log.Printf("Error Encoding JSON: %s", err)
+	}
 }
 func (c *Core) apiGetUserProfile(wr http.ResponseWriter, req *http.Request) {
 	handle := mux.Vars(req)["handle"]
 	if !isAlphaNumeric(handle) {
-		wr.WriteHeader(http.StatusNotFound)
+		apiNotFoundError.write(wr)
+		return
+	}
+	user, err := c.dao.getUserProfileByHandle(handle)
+	if errors.Is(err, sql.ErrNoRows) {
+		if !c.redirectOldHandle(wr, req, handle) {
+			apiNotFoundError.write(wr)
+		}
+		return
+	} else if err != nil {
+		log.Println("apiGetUserProfile().getUserProfileByHandle failed", err)
+		apiServerError.write(wr)
 		return
 	}
-	user, _ := c.dao.getUserProfileByHandle(handle)
-	user.Friends = []UserProfile{} // remove user friends
 	if err := json.NewEncoder(wr).Encode(user); err != nil {
 		log.Printf("Error Encoding JSON: %s", err)
 	}
@@ -271,7 +363,7 @@ func (c *Core) apiGetUserProfile(wr http.ResponseWriter, req *http.Request) {
 func (c *Core) apiGetComments(wr http.ResponseWriter, req *http.Request) {
 	postID := uuid.FromStringOrNil(mux.Vars(req)["guid"])
 	if postID == uuid.Nil {
-		wr.WriteHeader(http.StatusNotFound)
+		apiNotFoundError.write(wr)
 		return
 	}
 
@@ -291,7 +383,7 @@ func (c *Core) apiPostIncreaseView(wr http.ResponseWriter, req *http.Request) {
 
 	if err := json.NewDecoder(req.Body).Decode(&payload); err != nil {
 		log.Println("apiIncreaseView.Decode() failed", err)
-		wr.WriteHeader(http.StatusInternalServerError)
+		apiBadJSONError.write(wr)
 		return
 	}
 
@@ -302,7 +394,7 @@ func (c *Core) apiClaimPost(wr http.ResponseWriter, req *http.Request) {
 	userID := uuid.FromStringOrNil(mux.Vars(req)["uuid"])
 
 	if userID == uuid.Nil {
-		wr.WriteHeader(http.StatusNotFound)
+		apiNotFoundError.write(wr)
 		return
 	}
 	msg := "ok"
@@ -324,7 +416,7 @@ func (c *Core) apiDeletePost(wr http.ResponseWriter, req *http.Request) {
 	postID := uuid.FromStringOrNil(slug)
 
 	if postID == uuid.Nil {
-		wr.WriteHeader(http.StatusNotFound)
+		apiNotFoundError.write(wr)
 		return
 	}
 	c.dao.deletePost(postID)
@@ -344,28 +436,37 @@ func (c *Core) apiPutCash(wr http.ResponseWriter, req *http.Request) {
 	postID := uuid.FromStringOrNil(slug)
 
 	if postID == uuid.Nil {
-		wr.WriteHeader(http.StatusNotFound)
+		apiNotFoundError.write(wr)
 		return
 	}
 
 	u := GetSessionFromContext(req)
 	if u == nil {
 		log.Println("No user context")
-		wr.WriteHeader(http.StatusNotFound)
+		apiUnauthorizedError.write(wr)
 		return
 	}
 
 	payload := Post{}
 	if err := json.NewDecoder(req.Body).Decode(&payload); err != nil {
 		log.Println("apiPutCash.Decode() failed", err)
-		wr.WriteHeader(http.StatusInternalServerError)
+		apiBadJSONError.write(wr)
 		return
 	}
 
+	if err := validatePost(payload); err != nil {
+		validationResponse(wr, err)
+		return
+	}
+	c.canonicalisePost(&payload)
+
 	result, err := c.dao.updatePost(u.UserID, payload)
-	if err != nil {
+	if errors.Is(err, sql.ErrNoRows) {
+		apiNotFoundError.write(wr)
+		return
+	} else if err != nil {
 		log.Println("updatePost() Failed", err)
-		wr.WriteHeader(http.StatusNotFound)
+		apiServerError.write(wr)
 		return
 	}
 
@@ -387,7 +488,7 @@ func (c *Core) apiGetUsersMostRecent(wr http.ResponseWriter, req *http.Request)
 	userID := uuid.FromStringOrNil(mux.Vars(req)["guid"])
 	if userID == uuid.Nil {
 		log.Println("got uuid.Nil")
-		wr.WriteHeader(http.StatusNotFound)
+		apiNotFoundError.write(wr)
 		return
 	}
 
@@ -411,14 +512,17 @@ func (c *Core) apiGetCash(wr http.ResponseWriter, req *http.Request) {
 
 	if postID == uuid.Nil {
 		log.Println("got uuid.Nil")
-		wr.WriteHeader(http.StatusNotFound)
+		apiNotFoundError.write(wr)
 		return
 	}
 
 	result, err := c.dao.getPost(postID)
-	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+	if errors.Is(err, sql.ErrNoRows) {
+		apiNotFoundError.write(wr)
+		return
+	} else if err != nil {
 		log.Println("getPost() Failed", err)
-		wr.WriteHeader(http.StatusNotFound)
+		apiServerError.write(wr)
 		return
 	}
 
@@ -431,17 +535,13 @@ func (c *Core) apiGetCash(wr http.ResponseWriter, req *http.Request) {
 func (c *Core) apiPostCash(wr http.ResponseWriter, req *http.Request) {
 	u := GetSessionFromContext(req)
 	if u == nil {
-		log.Println("Invalid post", u.Username)
-		wr.WriteHeader(http.StatusNotFound)
+		apiUnauthorizedError.write(wr)
 		return
 	}
-	payload := struct {
-		File     string `json:"file,omitempty"`
-		Filename string `json:"filename,omitempty"`
-	}{}
+	payload := imageUpload{}
 	if err := json.NewDecoder(req.Body).Decode(&payload); err != nil {
 		log.Println("apiPostCash Decode() Failed", err)
-		wr.WriteHeader(http.StatusInternalServerError)
+		apiBadJSONError.write(wr)
 		return
 	}
 
@@ -449,52 +549,19 @@ func (c *Core) apiPostCash(wr http.ResponseWriter, req *http.Request) {
 	dec, err := base64.StdEncoding.DecodeString(payload.File)
 	if err != nil {
 		log.Println("DecodeString() Failed", err)
-		wr.WriteHeader(http.StatusInternalServerError)
+		apiBadRequestError.withMessage("The file isn't valid base64").write(wr)
 		return
 	}
 
-	var generatedImageURI string
+	fileName := payload.Filename
 	if c.useS3 {
-		suffix := filepath.Ext(payload.Filename)
-		fileName := fmt.Sprintf("%s%s", uuid.Must(uuid.NewV4()), suffix)
-		uploader := s3manager.NewUploader(awsSession)
-		fileType := http.DetectContentType(dec)
-
-		resp, err := uploader.Upload(&s3manager.UploadInput{
-			Bucket:      aws.String("showcash-uploads"),
-			Key:         aws.String(fileName),
-			Body:        bytes.NewReader(dec),
-			ContentType: aws.String(fileType),
-		})
-		if err != nil {
-			log.Println("s3 upload() Failed", err)
-			wr.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-		log.Println("Uploaded to:", resp.Location)
-		generatedImageURI = fmt.Sprintf("https://images.showcash.io/%s", fileName)
-
-	} else {
-		generatedImageURI = fmt.Sprintf("http://localhost:8080/static/%s", payload.Filename)
-		// Put it local
-		f, err := os.Create(fmt.Sprintf("../../static/%s", payload.Filename))
-		if err != nil {
-			log.Println("Create() failed", err)
-			wr.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-		defer f.Close()
-
-		if _, err := f.Write(dec); err != nil {
-			log.Println("Write() Failed", err)
-			wr.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-		if err := f.Sync(); err != nil {
-			log.Println("Sync() Failed", err)
-			wr.WriteHeader(http.StatusInternalServerError)
-			return
-		}
+		fileName = fmt.Sprintf("%s%s", uuid.Must(uuid.NewV4()), filepath.Ext(payload.Filename))
+	}
+	generatedImageURI, err := c.storeImage(fileName, dec)
+	if err != nil {
+		log.Println("storeImage() Failed", err)
+		apiServerError.write(wr)
+		return
 	}
 
 	newPost := Post{
@@ -0,0 +1,96 @@
+package showcash
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/handlers"
+)
+
+// CORSConfig is who can call the API from a browser. Origins can start
+// with a wildcard subdomain like https://*.showcash.io for previews.
+type CORSConfig struct {
+	AllowedOrigins []string
+	AllowedMethods []string
+	AllowedHeaders []string
+	MaxAge         int // seconds a preflight can be cached, 600 at most
+}
+
+// DefaultCORSConfig is what the API has always allowed
+func DefaultCORSConfig() CORSConfig {
+	return CORSConfig{
+		AllowedOrigins: []string{"http://localhost:8080", "http://localhost:8081", "https://api.showcash.io", "https://showcash.io"},
+		AllowedMethods: []string{
+			http.MethodGet,
+			http.MethodHead,
+			http.MethodPost,
+			http.MethodPut,
+			http.MethodDelete,
+			http.MethodOptions,
+			http.MethodPatch,
+		},
+		AllowedHeaders: []string{"X-Requested-With", "Authorization", "Access-Control-Allow-Methods", "Access-Control-Allow-Origin", "Origin", "Accept", "Content-Type"},
+		MaxAge:         600,
+	}
+}
+
+// originAllowed checks origin against the allowed list, where a pattern
+// like https://*.showcash.io matches any subdomain but not showcash.io
+func (cc CORSConfig) originAllowed(origin string) bool {
+	if origin == "" || origin == "null" {
+		return false
+	}
+	origin = strings.ToLower(origin)
+	for _, pattern := range cc.AllowedOrigins {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		i := strings.Index(pattern, "://*.")
+		if i < 0 {
+			if pattern == origin {
+				return true
+			}
+			continue
+		}
+
+		prefix, suffix := pattern[:i+3], pattern[i+4:]
+		if !strings.HasPrefix(origin, prefix) || !strings.HasSuffix(origin, suffix) || len(origin) <= len(prefix)+len(suffix) {
+			continue
+		}
+		if sub := origin[len(prefix) : len(origin)-len(suffix)]; isSubdomain(sub) {
+			return true
+		}
+	}
+	return false
+}
+
+// isSubdomain makes sure a wildcard only ever matches host labels, so
+// https://*.showcash.io can't match https://evil.com/.showcash.io
+func isSubdomain(s string) bool {
+	if strings.HasPrefix(s, ".") || strings.HasSuffix(s, ".") || strings.Contains(s, "..") {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if !isHostByte(s[i]) && s[i] != '.' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// middleware applies the policy, the same for every router
+func (cc CORSConfig) middleware() func(http.Handler) http.Handler {
+	cors := handlers.CORS(
+		handlers.AllowedMethods(cc.AllowedMethods),
+		handlers.AllowedHeaders(cc.AllowedHeaders),
+		handlers.AllowedOriginValidator(cc.originAllowed),
+		handlers.MaxAge(cc.MaxAge),
+		handlers.AllowCredentials(),
+	)
+	return func(next http.Handler) http.Handler {
+		h := cors(next)
+		return http.HandlerFunc(func(wr http.ResponseWriter, req *http.Request) {
+			// The answer depends on who's asking so caches need to know
+			wr.Header().Add("Vary", "Origin")
+			h.ServeHTTP(wr, req)
+		})
+	}
+}
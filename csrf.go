@@ -0,0 +1,60 @@
+package showcash
+
+import (
+	"net/http"
+	"net/url"
+)
+
+// safeMethods can't change anything so don't need CSRF checks
+var safeMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodOptions: true,
+}
+
+// requestOrigin is the Origin header, or the origin of the Referer when a
+// browser leaves Origin off
+func requestOrigin(req *http.Request) string {
+	if origin := req.Header.Get("Origin"); origin != "" {
+		return origin
+	}
+	if ref, err := url.Parse(req.Header.Get("Referer")); err == nil && ref.Scheme != "" && ref.Host != "" {
+		return ref.Scheme + "://" + ref.Host
+	}
+	return ""
+}
+
+// csrfMiddleware stops other sites making state changing requests that
+// ride on the session cookie. Browsers always say where a cross site
+// request came from, so anything with a cookie that doesn't say is
+// refused. Bearer tokens aren't sent automatically so they're exempt.
+func csrfMiddleware(allowed func(origin string) bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(wr http.ResponseWriter, req *http.Request) {
+			if safeMethods[req.Method] {
+				next.ServeHTTP(wr, req)
+				return
+			}
+			if _, ok := bearerToken(req); ok {
+				next.ServeHTTP(wr, req)
+				return
+			}
+
+			origin := requestOrigin(req)
+			if origin == "" {
+				if _, err := req.Cookie("showcash"); err != nil {
+					// No cookie, nothing to forge
+					next.ServeHTTP(wr, req)
+					return
+				}
+				apiForbiddenError.withCode("csrf").withMessage("Missing Origin header").write(wr)
+				return
+			}
+			if !allowed(origin) {
+				apiForbiddenError.withCode("csrf").withMessage("Cross site request refused").write(wr)
+				return
+			}
+			next.ServeHTTP(wr, req)
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package showcash
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func Test_csrfMiddleware(t *testing.T) {
+	h := csrfMiddleware(DefaultCORSConfig().originAllowed)(http.HandlerFunc(func(wr http.ResponseWriter, req *http.Request) {
+		wr.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name    string
+		method  string
+		headers map[string]string
+		cookie  bool
+		want    int
+	}{
+		{"safe method", http.MethodGet, map[string]string{"Origin": "https://evil.example"}, true, http.StatusOK},
+		{"our frontend", http.MethodPost, map[string]string{"Origin": "https://showcash.io"}, true, http.StatusOK},
+		{"other site", http.MethodPost, map[string]string{"Origin": "https://evil.example"}, true, http.StatusForbidden},
+		{"other site without a cookie", http.MethodPost, map[string]string{"Origin": "https://evil.example"}, false, http.StatusForbidden},
+		{"referer from our frontend", http.MethodPut, map[string]string{"Referer": "https://showcash.io/profile"}, true, http.StatusOK},
+		{"referer from another site", http.MethodDelete, map[string]string{"Referer": "https://evil.example/showcash.io"}, true, http.StatusForbidden},
+		{"no origin with a cookie", http.MethodPost, nil, true, http.StatusForbidden},
+		{"no origin or cookie", http.MethodPost, nil, false, http.StatusOK},
+		{"bearer token", http.MethodPost, map[string]string{"Authorization": "Bearer sc_abc", "Origin": "https://evil.example"}, true, http.StatusOK},
+		{"null origin", http.MethodPost, map[string]string{"Origin": "null"}, true, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/api/me", nil)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			if tt.cookie {
+				req.AddCookie(&http.Cookie{Name: "showcash", Value: "x"})
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("got %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
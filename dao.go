@@ -60,8 +60,12 @@ func NewDAO(username, password string, host string, port int, database string) (
 	return d, nil
 }
 
-// IsConnected is a healthcheck for the DAO
-// In memory versions would be static but DB backed would ping()
+// Close releases the database connections
+func (d *DAO) Close() error {
+	return d.db.Close()
+}
+
+// IsConnected is a healthcheck for the DAO, it pings the database
 func (d *DAO) IsConnected() bool {
 	if d == nil {
 		return false
@@ -138,16 +142,18 @@ func (d *DAO) updatePost(userID uuid.UUID, p Post) (Post, error) {
 				title,
 				description,
 				link,
+				canonical_link,
 				"left",
 				top
 			) VALUES (
-				 $1, $2, $3, $4, $5, $6, $7
+				 $1, $2, $3, $4, $5, $6, $7, $8
 			) 
 			ON CONFLICT (post_id, id) 
 			DO UPDATE SET
 				title = EXCLUDED.title,
 				description = EXCLUDED.description,
 				link = EXCLUDED.link,
+				canonical_link = EXCLUDED.canonical_link,
 				"left" = EXCLUDED."left",
 				top = EXCLUDED.top
 				`,
@@ -156,6 +162,7 @@ func (d *DAO) updatePost(userID uuid.UUID, p Post) (Post, error) {
 			p.ItemList[i].Title,
 			p.ItemList[i].Description,
 			p.ItemList[i].Link,
+			p.ItemList[i].CanonicalLink,
 			p.ItemList[i].Left,
 			p.ItemList[i].Top,
 		)
@@ -179,7 +186,7 @@ func (d *DAO) getPost(postID uuid.UUID) (Post, error) {
 			u.username
 		FROM
 			showcash.post AS p JOIN showcash.user AS u ON u.user_id = p.user_id
-		WHERE id = $1
+		WHERE id = $1 AND NOT p.hidden
 		LIMIT 1`, postID,
 	); err != nil {
 		return p, err
@@ -194,6 +201,7 @@ func (d *DAO) getPost(postID uuid.UUID) (Post, error) {
 			title,
 			description,
 			link,
+			canonical_link,
 			"left",
 			top
 		FROM 
@@ -245,6 +253,7 @@ func (d *DAO) getLatestPosts() []Post {
 		&posts,
 		`SELECT p.id,p.imageuri,p.title,p.date,
 		u.username FROM showcash.post AS p JOIN showcash.user AS u ON p.user_id = u.user_id
+		WHERE NOT p.hidden
 		ORDER BY p.created_at DESC   
 		LIMIT 8`,
 	)
@@ -260,7 +269,7 @@ func (d *DAO) getUsersLatestPosts(userID uuid.UUID) []Post {
 		&posts,
 		`SELECT p.id,p.imageuri,p.title,p.date,
 		u.username FROM showcash.post AS p JOIN showcash.user AS u ON p.user_id = u.user_id
-		WHERE u.user_id = $1
+		WHERE u.user_id = $1 AND NOT p.hidden
 		ORDER BY p.created_at DESC   
 		LIMIT 50`, userID,
 	)
@@ -278,7 +287,7 @@ func (d *DAO) getMostViewedPosts() []Post {
 		`SELECT p.id,p.imageuri,p.title,p.date,u.username FROM showcash.post AS p JOIN showcash.user AS u ON p.user_id = u.user_id JOIN LATERAL (  
 			SELECT post_id, LOG(10,COUNT(*) + 1) * 287015 + ( SELECT extract(epoch FROM p.date)) AS rating   
 			FROM showcash.views GROUP BY views.post_id 
-		) AS pop ON pop.post_id = p.id ORDER BY pop.rating DESC LIMIT 8`,
+		) AS pop ON pop.post_id = p.id WHERE NOT p.hidden ORDER BY pop.rating DESC LIMIT 8`,
 	)
 	if err != nil && !errors.Is(err, sql.ErrNoRows) {
 		log.Println("getMostViewedPosts() failed", err)
@@ -298,7 +307,7 @@ func (d *DAO) getCommentsForPostID(postID uuid.UUID) []Comment {
 			user_id
 		FROM 
 			showcash.comments
-		WHERE post_id = $1`, postID)
+		WHERE post_id = $1 AND NOT hidden`, postID)
 	if err != nil && !errors.Is(err, sql.ErrNoRows) {
 		log.Println("getCommentsForPostID() failed", err)
 	}
@@ -338,15 +347,18 @@ func (d *DAO) getUserProfileByID(userID uuid.UUID) (UserProfile, error) {
 			social_1,
 			social_2,
 			social_3,
+			social_1_url,
+			social_2_url,
+			social_3_url,
 			created_at
 		FROM 
 			showcash.user
 		WHERE user_id = $1`, userID,
 	)
+	up.UserID = userID
 
-	up.Interests = []string{"MFA"}
-	up.Friends = []UserProfile{}
-	up.Followers = []UserProfile{}
+	up.Interests = d.getInterests(up.UserID)
+	d.hydrateFollows(&up)
 
 	return up, err
 }
@@ -364,23 +376,31 @@ func (d *DAO) getUserProfileByHandle(handle string) (UserProfile, error) {
 			social_1,
 			social_2,
 			social_3,
+			social_1_url,
+			social_2_url,
+			social_3_url,
 			created_at
 		FROM 
 			showcash.user
-		WHERE username = $1`, handle,
+		WHERE username = $1 AND NOT hidden`, handle,
 	)
 
-	up.Interests = []string{"MFA"}
-	up.Friends = []UserProfile{}
-	up.Followers = []UserProfile{}
+	up.Interests = d.getInterests(up.UserID)
+	d.hydrateFollows(&up)
 
 	return up, err
 }
 
-func (d *DAO) getUserByUsernameAndPassword(username, password string) (User, error) {
-	u := User{}
-	err := d.db.Get(&u,
-		`SELECT	
+func (d *DAO) getUserIDByHandle(handle string) (uuid.UUID, error) {
+	var userID uuid.UUID
+	err := d.db.Get(&userID,
+		`SELECT user_id FROM showcash.user WHERE username = $1 AND NOT hidden`, handle,
+	)
+	return userID, err
+}
+
+// loginColumns are the user columns handed back on a successful login
+const loginColumns = `
 			user_id,
 			username,
 			realname,
@@ -390,21 +410,58 @@ func (d *DAO) getUserByUsernameAndPassword(username, password string) (User, err
 			social_1,
 			social_2,
 			social_3,
+			social_1_url,
+			social_2_url,
+			social_3_url,
 			email_address,
 			password,
-			shadow_banned
+			shadow_banned,
+			email_verified,
+			totp_enabled`
+
+// getUserByUsernameAndPassword ignores case, handles are unique ignoring
+// case so there's at most one match
+func (d *DAO) getUserByUsernameAndPassword(username, password string) (User, error) {
+	u := User{}
+	err := d.db.Get(&u,
+		`SELECT`+loginColumns+`
 		FROM 
 			showcash.user
-		WHERE username = $1 AND password = $2`, username, password,
+		WHERE lower(username) = lower($1) AND password = $2`, username, password,
 	)
 
 	return u, err
 }
 
-func (d *DAO) createUser(u User) (User, error) {
-	u.UserID = uuid.Must(uuid.NewV4())
-	_, err := d.db.NamedExec(
-		`INSERT INTO showcash.user(
+// getLoginUser is the user as returned by a login, for when the password
+// has already been checked
+func (d *DAO) getLoginUser(userID uuid.UUID) (User, error) {
+	u := User{}
+	err := d.db.Get(&u,
+		`SELECT`+loginColumns+`
+		FROM 
+			showcash.user
+		WHERE user_id = $1`, userID,
+	)
+
+	return u, err
+}
+
+func (d *DAO) getUserByEmailAndPassword(email, password string) (User, error) {
+	u := User{}
+	err := d.db.Get(&u,
+		`SELECT`+loginColumns+`
+		FROM 
+			showcash.user
+		WHERE lower(email_address) = lower($1) AND password = $2`, email, password,
+	)
+
+	return u, err
+}
+
+// createUserSQL is shared by signups with and without a provider login
+const createUserSQL = `
+		INSERT INTO showcash.user(
 			user_id,
 			username,
 			realname,
@@ -414,6 +471,9 @@ func (d *DAO) createUser(u User) (User, error) {
 			social_1,
 			social_2,
 			social_3,
+			social_1_url,
+			social_2_url,
+			social_3_url,
 			email_address,
 			password
 		) VALUES (
@@ -426,10 +486,16 @@ func (d *DAO) createUser(u User) (User, error) {
 			:social_1,
 			:social_2,
 			:social_3,
+			:social_1_url,
+			:social_2_url,
+			:social_3_url,
 			:email_address,
 			:password
-		)`, u,
-	)
+		)`
+
+func (d *DAO) createUser(u User) (User, error) {
+	u.UserID = uuid.Must(uuid.NewV4())
+	_, err := d.db.NamedExec(createUserSQL, u)
 	return u, err
 }
 
@@ -441,9 +507,13 @@ func (d *DAO) updateUser(u User) (User, error) {
 			bio        = $3,
 			social_1   = $4,
 			social_2   = $5,
-			social_3   = $6
-			WHERE user_id = $7`,
-		u.RealName, u.Location, u.Bio, u.Social1, u.Social2, u.Social3, u.UserID,
+			social_3   = $6,
+			social_1_url = $7,
+			social_2_url = $8,
+			social_3_url = $9
+			WHERE user_id = $10`,
+		u.RealName, u.Location, u.Bio, u.Social1, u.Social2, u.Social3,
+		u.Social1URL, u.Social2URL, u.Social3URL, u.UserID,
 	)
 
 	return u, err
@@ -551,7 +621,7 @@ func (d *DAO) getPostsByTags(tags []string) []Post {
 			JOIN showcash.user AS u ON p.user_id = u.user_id
 			JOIN showcash.posttag AS pt ON pt.post_id = p.id
 			JOIN showcash.tag AS t ON t.tag_id = pt.tag_id
-		WHERE t.tag = ANY($1)
+		WHERE t.tag = ANY($1) AND NOT p.hidden
 		ORDER BY p.id,p.date DESC
 		LIMIT 50
 		`, pq.Array(tags),
@@ -561,3 +631,1172 @@ func (d *DAO) getPostsByTags(tags []string) []Post {
 	}
 	return posts
 }
+
+// reportTargets maps a report target type to the table and key holding it
+var reportTargets = map[string]struct {
+	table string
+	key   string
+}{
+	"post":    {"showcash.post", "id"},
+	"comment": {"showcash.comments", "id"},
+	"user":    {"showcash.user", "user_id"},
+}
+
+func (d *DAO) createReport(r Report) (Report, error) {
+	r.ID = uuid.Must(uuid.NewV4())
+	r.CreatedAt = time.Now()
+	_, err := d.db.NamedExec(
+		`INSERT INTO showcash.report(
+			id,
+			reporter_id,
+			target_type,
+			target_id,
+			reason,
+			created_at
+		) VALUES (
+			:id,
+			:reporter_id,
+			:target_type,
+			:target_id,
+			:reason,
+			:created_at
+		)`, r,
+	)
+	return r, err
+}
+
+// reportTargetExists stops people reporting things that were never there
+func (d *DAO) reportTargetExists(targetType string, targetID uuid.UUID) bool {
+	t, ok := reportTargets[targetType]
+	if !ok {
+		return false
+	}
+	var exists bool
+	err := d.db.Get(&exists,
+		fmt.Sprintf(`SELECT EXISTS(SELECT 1 FROM %s WHERE %s = $1)`, t.table, t.key),
+		targetID,
+	)
+	if err != nil {
+		log.Println("reportTargetExists() failed", err)
+	}
+	return exists
+}
+
+// hideIfReported hides the target once it has been reported by at least
+// threshold different users. A threshold of zero disables hiding.
+func (d *DAO) hideIfReported(targetType string, targetID uuid.UUID, threshold int) (bool, error) {
+	t, ok := reportTargets[targetType]
+	if !ok || threshold <= 0 {
+		return false, nil
+	}
+	res, err := d.db.Exec(
+		fmt.Sprintf(`UPDATE %s SET hidden = TRUE
+			WHERE %s = $1 AND NOT hidden AND (
+				SELECT COUNT(*) FROM showcash.report
+				WHERE target_type = $2 AND target_id = $1
+			) >= $3`, t.table, t.key),
+		targetID, targetType, threshold,
+	)
+	if err != nil {
+		return false, err
+	}
+	cnt, err := res.RowsAffected()
+	return cnt > 0, err
+}
+
+func (d *DAO) getReportSummaries() []ReportSummary {
+	var summaries []ReportSummary
+	err := d.db.Select(
+		&summaries,
+		`SELECT
+			r.target_type,
+			r.target_id,
+			COUNT(*) AS reports,
+			ARRAY_AGG(r.reason) AS reasons,
+			COALESCE(p.hidden, c.hidden, u.hidden, FALSE) AS hidden,
+			MAX(r.created_at) AS last_reported
+		FROM showcash.report AS r
+			LEFT JOIN showcash.post AS p ON r.target_type = 'post' AND p.id = r.target_id
+			LEFT JOIN showcash.comments AS c ON r.target_type = 'comment' AND c.id = r.target_id
+			LEFT JOIN showcash.user AS u ON r.target_type = 'user' AND u.user_id = r.target_id
+		GROUP BY r.target_type, r.target_id, p.hidden, c.hidden, u.hidden
+		ORDER BY reports DESC, last_reported DESC
+		LIMIT 100`,
+	)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Println("getReportSummaries() failed", err)
+	}
+	return summaries
+}
+
+func (d *DAO) isModerator(userID uuid.UUID) bool {
+	var moderator bool
+	err := d.db.Get(&moderator,
+		`SELECT moderator FROM showcash.user WHERE user_id = $1`, userID,
+	)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Println("isModerator() failed", err)
+	}
+	return moderator
+}
+
+func (d *DAO) getFilterRules() ([]FilterRule, error) {
+	var rules []FilterRule
+	err := d.db.Select(
+		&rules,
+		`SELECT
+			pattern,
+			category,
+			match
+		FROM
+			showcash.filter_rule`,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return rules, nil
+	}
+	return rules, err
+}
+
+// profileFollowPreview is how many friends and followers come back
+// with a profile - the rest are paged through separately
+const profileFollowPreview = 12
+
+// hydrateFollows fills in the follow graph for a profile
+func (d *DAO) hydrateFollows(up *UserProfile) {
+	up.Friends = []UserProfile{}
+	up.Followers = []UserProfile{}
+	if up.UserID == uuid.Nil {
+		return
+	}
+	up.Friends = d.getFollowing(up.UserID, profileFollowPreview, 0)
+	up.Followers = d.getFollowers(up.UserID, profileFollowPreview, 0)
+	// Counted the same way as the lists, so they add up
+	err := d.db.QueryRow(
+		`SELECT
+			(SELECT COUNT(*) FROM showcash.follows AS f JOIN showcash.user AS u ON u.user_id = f.follower_id
+				WHERE f.followee_id = $1 AND NOT u.hidden AND NOT u.shadow_banned),
+			(SELECT COUNT(*) FROM showcash.follows AS f JOIN showcash.user AS u ON u.user_id = f.followee_id
+				WHERE f.follower_id = $1 AND NOT u.hidden AND NOT u.shadow_banned)`,
+		up.UserID,
+	).Scan(&up.FollowerCount, &up.FollowingCount)
+	if err != nil {
+		log.Println("hydrateFollows() failed", err)
+	}
+}
+
+func (d *DAO) follow(followerID, followeeID uuid.UUID) error {
+	_, err := d.db.Exec(
+		`INSERT INTO showcash.follows (
+			follower_id,
+			followee_id
+		) VALUES (
+			$1, $2
+		) ON CONFLICT (follower_id, followee_id) DO NOTHING`,
+		followerID, followeeID,
+	)
+	return err
+}
+
+func (d *DAO) unfollow(followerID, followeeID uuid.UUID) error {
+	_, err := d.db.Exec(
+		`DELETE FROM showcash.follows WHERE follower_id = $1 AND followee_id = $2`,
+		followerID, followeeID,
+	)
+	return err
+}
+
+// getFollowers is everyone following userID, most recent first
+func (d *DAO) getFollowers(userID uuid.UUID, limit, offset int) []UserProfile {
+	followers := []UserProfile{}
+	err := d.db.Select(
+		&followers,
+		`SELECT u.user_id, u.username, u.realname, u.profile_uri
+		FROM showcash.follows AS f JOIN showcash.user AS u ON u.user_id = f.follower_id
+		WHERE f.followee_id = $1 AND NOT u.hidden AND NOT u.shadow_banned
+		ORDER BY f.created_at DESC
+		LIMIT $2 OFFSET $3`, userID, limit, offset,
+	)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Println("getFollowers() failed", err)
+	}
+	return followers
+}
+
+// getFollowing is everyone userID follows, most recent first
+func (d *DAO) getFollowing(userID uuid.UUID, limit, offset int) []UserProfile {
+	following := []UserProfile{}
+	err := d.db.Select(
+		&following,
+		`SELECT u.user_id, u.username, u.realname, u.profile_uri
+		FROM showcash.follows AS f JOIN showcash.user AS u ON u.user_id = f.followee_id
+		WHERE f.follower_id = $1 AND NOT u.hidden AND NOT u.shadow_banned
+		ORDER BY f.created_at DESC
+		LIMIT $2 OFFSET $3`, userID, limit, offset,
+	)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Println("getFollowing() failed", err)
+	}
+	return following
+}
+
+// hasFollows is true if the user follows anyone or any tag
+func (d *DAO) hasFollows(userID uuid.UUID) bool {
+	var follows bool
+	err := d.db.Get(&follows,
+		`SELECT
+			EXISTS(SELECT 1 FROM showcash.follows WHERE follower_id = $1) OR
+			EXISTS(SELECT 1 FROM showcash.tagfollows WHERE user_id = $1)`,
+		userID,
+	)
+	if err != nil {
+		log.Println("hasFollows() failed", err)
+	}
+	return follows
+}
+
+// getFeed is posts by followed users or with followed tags, newest first,
+// starting after the cursor (if there is one)
+func (d *DAO) getFeed(userID uuid.UUID, cursor *feedCursor, limit int) []Post {
+	var after, afterID interface{}
+	if cursor != nil {
+		after, afterID = cursor.Date, cursor.ID
+	}
+
+	var posts []Post
+	err := d.db.Select(
+		&posts,
+		`SELECT p.id,p.imageuri,p.title,p.date,u.username
+		FROM showcash.post AS p JOIN showcash.user AS u ON p.user_id = u.user_id
+		WHERE NOT p.hidden AND (
+			p.user_id IN (SELECT followee_id FROM showcash.follows WHERE follower_id = $1)
+			OR p.id IN (
+				SELECT pt.post_id FROM showcash.posttag AS pt
+				JOIN showcash.tagfollows AS tf ON tf.tag_id = pt.tag_id
+				WHERE tf.user_id = $1
+			)
+		) AND ($2::TIMESTAMPTZ IS NULL OR (p.date, p.id) < ($2::TIMESTAMPTZ, $3::UUID))
+		ORDER BY p.date DESC, p.id DESC
+		LIMIT $4`, userID, after, afterID, limit,
+	)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Println("getFeed() failed", err)
+	}
+	return posts
+}
+
+func (d *DAO) followTags(userID uuid.UUID, tags []string) error {
+	tags = cleanTags(tags)
+	if len(tags) == 0 {
+		return nil
+	}
+	return followTagsWith(d.db, userID, tags)
+}
+
+// followTagsWith creates the tags and follows them with ex, so it can be
+// part of a transaction
+func followTagsWith(ex sqlx.Execer, userID uuid.UUID, tags []string) error {
+	if _, err := ex.Exec(
+		`INSERT INTO showcash.tag(tag) SELECT unnest($1::text[]) ON CONFLICT DO NOTHING`,
+		pq.Array(tags),
+	); err != nil {
+		return err
+	}
+	_, err := ex.Exec(
+		`INSERT INTO showcash.tagfollows(user_id, tag_id)
+			SELECT $1, t.tag_id FROM showcash.tag AS t
+			WHERE t.tag = ANY($2)
+		ON CONFLICT DO NOTHING`,
+		userID,
+		pq.Array(tags),
+	)
+	return err
+}
+
+func (d *DAO) unfollowTags(userID uuid.UUID, tags []string) error {
+	_, err := d.db.Exec(
+		`DELETE FROM showcash.tagfollows USING showcash.tag
+			WHERE showcash.tagfollows.tag_id = showcash.tag.tag_id
+				AND showcash.tag.tag = ANY($1) AND showcash.tagfollows.user_id = $2`,
+		pq.Array(tags),
+		userID,
+	)
+	return err
+}
+
+// getInterests is the tags a user follows
+func (d *DAO) getInterests(userID uuid.UUID) []string {
+	interests := []string{}
+	err := d.db.Select(
+		&interests,
+		`SELECT t.tag FROM showcash.tagfollows AS tf
+			JOIN showcash.tag AS t ON t.tag_id = tf.tag_id
+		WHERE tf.user_id = $1
+		ORDER BY t.tag`, userID,
+	)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Println("getInterests() failed", err)
+	}
+	return interests
+}
+
+// setInterests replaces the tags a user follows
+func (d *DAO) setInterests(userID uuid.UUID, interests []string) ([]string, error) {
+	interests = cleanTags(interests)
+	tx, err := d.db.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(
+		`DELETE FROM showcash.tagfollows USING showcash.tag
+			WHERE showcash.tagfollows.tag_id = showcash.tag.tag_id
+				AND showcash.tagfollows.user_id = $1 AND NOT showcash.tag.tag = ANY($2)`,
+		userID,
+		pq.Array(interests),
+	); err != nil {
+		return nil, err
+	}
+	if len(interests) > 0 {
+		if err := followTagsWith(tx, userID, interests); err != nil {
+			return nil, err
+		}
+	}
+	return interests, tx.Commit()
+}
+
+// setProfileURI returns the old profile_uri so it can be cleaned up
+func (d *DAO) setProfileURI(userID uuid.UUID, uri string) (string, error) {
+	var previous string
+	err := d.db.Get(&previous,
+		`UPDATE showcash.user AS u SET
+			profile_uri = $1
+		FROM (SELECT user_id, profile_uri FROM showcash.user WHERE user_id = $2) AS old
+		WHERE u.user_id = old.user_id
+		RETURNING old.profile_uri`,
+		uri, userID,
+	)
+	return previous, err
+}
+
+// changeUsername renames a user, keeping the old name reserved for them
+// and fixing up the usernames copied onto their comments
+func (d *DAO) changeUsername(userID uuid.UUID, username string, cooldown, reservation time.Duration) error {
+	tx, err := d.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var current string
+	var changedAt pq.NullTime
+	if err := tx.QueryRow(
+		`SELECT username, username_changed_at FROM showcash.user WHERE user_id = $1 FOR UPDATE`,
+		userID,
+	).Scan(&current, &changedAt); err != nil {
+		return err
+	}
+	if current == username {
+		return nil
+	}
+	if changedAt.Valid && time.Since(changedAt.Time) < cooldown {
+		return errUsernameCooldown
+	}
+
+	// Someone else's old handle is off limits until it expires
+	var reserved bool
+	if err := tx.Get(&reserved,
+		`SELECT EXISTS(
+			SELECT 1 FROM showcash.username_history
+			WHERE lower(username) = lower($1) AND user_id != $2 AND reserved_until > NOW()
+		)`, username, userID,
+	); err != nil {
+		return err
+	}
+	if reserved {
+		return errUsernameTaken
+	}
+
+	if _, err := tx.Exec(
+		`UPDATE showcash.user SET
+			username = $1,
+			username_changed_at = NOW()
+		WHERE user_id = $2`, username, userID,
+	); pgErrIs(err, errNotUnique) {
+		return errUsernameTaken
+	} else if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(
+		`INSERT INTO showcash.username_history (
+			username,
+			user_id,
+			changed_at,
+			reserved_until
+		) VALUES (
+			$1, $2, NOW(), $3
+		) ON CONFLICT (username) DO UPDATE SET
+			user_id = EXCLUDED.user_id,
+			changed_at = EXCLUDED.changed_at,
+			reserved_until = EXCLUDED.reserved_until`,
+		current, userID, time.Now().Add(reservation),
+	); err != nil {
+		return err
+	}
+
+	// Taking back one of your own old names
+	if _, err := tx.Exec(
+		`DELETE FROM showcash.username_history WHERE username = $1 AND user_id = $2`,
+		username, userID,
+	); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(
+		`UPDATE showcash.comments SET username = $1 WHERE user_id = $2`,
+		username, userID,
+	); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// getCurrentUsername follows a reserved old handle to the user's current one
+func (d *DAO) getCurrentUsername(oldHandle string) (string, error) {
+	var username string
+	err := d.db.Get(&username,
+		`SELECT u.username FROM showcash.username_history AS h
+			JOIN showcash.user AS u ON u.user_id = h.user_id
+		WHERE lower(h.username) = lower($1) AND h.reserved_until > NOW() AND NOT u.hidden
+		ORDER BY h.reserved_until DESC
+		LIMIT 1`,
+		oldHandle,
+	)
+	return username, err
+}
+
+func (d *DAO) isUsernameReserved(username string) bool {
+	var reserved bool
+	err := d.db.Get(&reserved,
+		`SELECT EXISTS(
+			SELECT 1 FROM showcash.username_history
+			WHERE lower(username) = lower($1) AND reserved_until > NOW()
+		)`, username,
+	)
+	if err != nil {
+		log.Println("isUsernameReserved() failed", err)
+	}
+	return reserved
+}
+
+func (d *DAO) createUserToken(t UserToken) error {
+	_, err := d.db.NamedExec(
+		`INSERT INTO showcash.user_token(
+			token_hash,
+			user_id,
+			purpose,
+			email_address,
+			expires_at
+		) VALUES (
+			:token_hash,
+			:user_id,
+			:purpose,
+			:email_address,
+			:expires_at
+		)`, t,
+	)
+	return err
+}
+
+// consumeUserToken marks a token as used, failing if it already was or
+// has expired
+func (d *DAO) consumeUserToken(tokenHash, purpose string) (UserToken, error) {
+	t := UserToken{}
+	err := d.db.Get(&t,
+		`UPDATE showcash.user_token SET
+			used_at = NOW()
+		WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > NOW()
+		RETURNING token_hash, user_id, purpose, email_address, expires_at`,
+		tokenHash, purpose,
+	)
+	return t, err
+}
+
+// setEmailVerified only verifies the address the token was sent to, in
+// case it has changed since
+func (d *DAO) setEmailVerified(userID uuid.UUID, email string) error {
+	res, err := d.db.Exec(
+		`UPDATE showcash.user SET email_verified = TRUE WHERE user_id = $1 AND email_address = $2`,
+		userID, email,
+	)
+	if err != nil {
+		return err
+	}
+	if cnt, err := res.RowsAffected(); err != nil || cnt == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (d *DAO) isEmailVerified(userID uuid.UUID) bool {
+	var verified bool
+	err := d.db.Get(&verified,
+		`SELECT email_verified FROM showcash.user WHERE user_id = $1`, userID,
+	)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Println("isEmailVerified() failed", err)
+	}
+	return verified
+}
+
+func (d *DAO) getEmailAddress(userID uuid.UUID) (string, error) {
+	var email string
+	err := d.db.Get(&email,
+		`SELECT email_address FROM showcash.user WHERE user_id = $1`, userID,
+	)
+	return email, err
+}
+
+func (d *DAO) getSessionEpoch(userID uuid.UUID) (int, error) {
+	var epoch int
+	err := d.db.Get(&epoch,
+		`SELECT session_epoch FROM showcash.user WHERE user_id = $1`, userID,
+	)
+	return epoch, err
+}
+
+func (d *DAO) getUserByEmail(email string) (User, error) {
+	u := User{}
+	err := d.db.Get(&u,
+		`SELECT
+			user_id,
+			username,
+			email_address
+		FROM
+			showcash.user
+		WHERE lower(email_address) = lower($1)`, email,
+	)
+	return u, err
+}
+
+// resetPassword sets a new password, logs out every session, revokes
+// every API token and burns any other reset links still floating around
+func (d *DAO) resetPassword(userID uuid.UUID, password string) error {
+	tx, err := d.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := resetPasswordTx(tx, userID, password); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// resetPasswordWithToken is resetPassword from a reset link, using the
+// link up in the same transaction so it still works if the reset fails
+func (d *DAO) resetPasswordWithToken(tokenHash string, userID uuid.UUID, password string) error {
+	tx, err := d.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(
+		`UPDATE showcash.user_token SET used_at = NOW()
+		WHERE token_hash = $1 AND user_id = $2 AND purpose = $3 AND used_at IS NULL AND expires_at > NOW()`,
+		tokenHash, userID, tokenResetPassword,
+	)
+	if err != nil {
+		return err
+	}
+	if cnt, err := res.RowsAffected(); err != nil || cnt == 0 {
+		return sql.ErrNoRows
+	}
+	if err := resetPasswordTx(tx, userID, password); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func resetPasswordTx(tx *sqlx.Tx, userID uuid.UUID, password string) error {
+	if _, err := tx.Exec(
+		`UPDATE showcash.user SET
+			password = $1,
+			session_epoch = session_epoch + 1
+		WHERE user_id = $2`, password, userID,
+	); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(
+		`UPDATE showcash.user_token SET used_at = NOW()
+		WHERE user_id = $1 AND purpose = $2 AND used_at IS NULL`,
+		userID, tokenResetPassword,
+	); err != nil {
+		return err
+	}
+	_, err := tx.Exec(
+		`UPDATE showcash.api_token SET revoked_at = NOW()
+		WHERE user_id = $1 AND revoked_at IS NULL`, userID,
+	)
+	return err
+}
+
+func (d *DAO) checkPassword(userID uuid.UUID, password string) bool {
+	var ok bool
+	err := d.db.Get(&ok,
+		`SELECT EXISTS(SELECT 1 FROM showcash.user WHERE user_id = $1 AND password = $2)`,
+		userID, password,
+	)
+	if err != nil {
+		log.Println("checkPassword() failed", err)
+	}
+	return ok
+}
+
+// changeEmail switches to an address the user has just verified
+func (d *DAO) changeEmail(userID uuid.UUID, email string) error {
+	_, err := d.db.Exec(
+		`UPDATE showcash.user SET
+			email_address = $1,
+			email_verified = TRUE
+		WHERE user_id = $2`, email, userID,
+	)
+	return err
+}
+
+// getAccountExport gathers everything we hold about a user, hidden
+// content included since it's still theirs
+func (d *DAO) getAccountExport(userID uuid.UUID) (AccountExport, error) {
+	ex := AccountExport{ExportedAt: time.Now()}
+	if err := d.db.Get(&ex.User,
+		`SELECT
+			user_id,
+			username,
+			realname,
+			location,
+			profile_uri,
+			bio,
+			social_1,
+			social_2,
+			social_3,
+			social_1_url,
+			social_2_url,
+			social_3_url,
+			email_address,
+			email_verified,
+			created_at
+		FROM
+			showcash.user
+		WHERE user_id = $1`, userID,
+	); err != nil {
+		return ex, err
+	}
+	ex.User.Interests = d.getInterests(userID)
+
+	var err error
+	if ex.Profile, err = d.getUserProfileByID(userID); err != nil {
+		return ex, err
+	}
+
+	if err := d.db.Select(&ex.Posts,
+		`SELECT p.id,p.imageuri,p.title,p.date,u.username
+		FROM showcash.post AS p JOIN showcash.user AS u ON p.user_id = u.user_id
+		WHERE p.user_id = $1
+		ORDER BY p.created_at`, userID,
+	); err != nil {
+		return ex, err
+	}
+	for i := range ex.Posts {
+		if err := d.db.Select(&ex.Posts[i].ItemList,
+			`SELECT id,title,description,link,canonical_link,"left",top
+			FROM showcash.item
+			WHERE post_id = $1
+			ORDER BY id`, ex.Posts[i].ID,
+		); err != nil {
+			return ex, err
+		}
+		if err := d.db.Select(&ex.Posts[i].Tags,
+			`SELECT t.tag FROM showcash.posttag AS pt
+				JOIN showcash.tag AS t ON t.tag_id = pt.tag_id
+			WHERE pt.post_id = $1
+			ORDER BY t.tag`, ex.Posts[i].ID,
+		); err != nil {
+			return ex, err
+		}
+	}
+
+	if err := d.db.Select(&ex.Comments,
+		`SELECT id,date,comment,username,user_id,post_id
+		FROM showcash.comments
+		WHERE user_id = $1
+		ORDER BY date`, userID,
+	); err != nil {
+		return ex, err
+	}
+	return ex, nil
+}
+
+// deleteAccount removes a user and their posts, anonymising their comments
+// on other people's posts so threads still make sense. It returns the
+// images that need removing from storage once it's committed.
+func (d *DAO) deleteAccount(userID uuid.UUID) ([]string, error) {
+	tx, err := d.db.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var images []string
+	if err := tx.Select(&images,
+		`SELECT imageuri FROM showcash.post WHERE user_id = $1 AND imageuri != ''
+		UNION ALL
+		SELECT profile_uri FROM showcash.user WHERE user_id = $1 AND profile_uri != ''`,
+		userID,
+	); err != nil {
+		return nil, err
+	}
+
+	statements := []string{
+		`DELETE FROM showcash.item WHERE post_id IN (SELECT id FROM showcash.post WHERE user_id = $1)`,
+		`DELETE FROM showcash.views WHERE post_id IN (SELECT id FROM showcash.post WHERE user_id = $1)`,
+		`DELETE FROM showcash.posttag WHERE post_id IN (SELECT id FROM showcash.post WHERE user_id = $1)`,
+		`DELETE FROM showcash.comments WHERE post_id IN (SELECT id FROM showcash.post WHERE user_id = $1)`,
+		`DELETE FROM showcash.post WHERE user_id = $1`,
+		`UPDATE showcash.comments SET
+			comment = '[deleted]',
+			username = '[deleted]',
+			user_id = '00000000-0000-0000-0000-000000000000'
+		WHERE user_id = $1`,
+		`DELETE FROM showcash.follows WHERE follower_id = $1 OR followee_id = $1`,
+		`DELETE FROM showcash.tagfollows WHERE user_id = $1`,
+		`DELETE FROM showcash.report WHERE reporter_id = $1`,
+		// Logins are by whatever was typed so go by every handle and email
+		// we know of too
+		`DELETE FROM showcash.login_attempt WHERE user_id = $1 OR login IN (
+			SELECT lower(username) FROM showcash.user WHERE user_id = $1
+			UNION SELECT lower(email_address) FROM showcash.user WHERE user_id = $1
+			UNION SELECT lower(username) FROM showcash.username_history WHERE user_id = $1
+			UNION SELECT provider || ':' || subject FROM showcash.oauth_identity WHERE user_id = $1
+		)`,
+		`DELETE FROM showcash.login_throttle WHERE key = 'user:' || $1::text OR key IN (
+			SELECT 'login:' || lower(username) FROM showcash.user WHERE user_id = $1
+			UNION SELECT 'login:' || lower(email_address) FROM showcash.user WHERE user_id = $1
+		)`,
+		`DELETE FROM showcash.user_token WHERE user_id = $1`,
+		`DELETE FROM showcash.recovery_code WHERE user_id = $1`,
+		`DELETE FROM showcash.oauth_identity WHERE user_id = $1`,
+		`DELETE FROM showcash.api_token WHERE user_id = $1`,
+		`DELETE FROM showcash.username_history WHERE user_id = $1`,
+		`DELETE FROM showcash.user WHERE user_id = $1`,
+	}
+	for _, stmt := range statements {
+		if _, err := tx.Exec(stmt, userID); err != nil {
+			return nil, err
+		}
+	}
+	return images, tx.Commit()
+}
+
+func (d *DAO) createAccountJob(userID uuid.UUID, kind string) (AccountJob, error) {
+	j := AccountJob{
+		ID:        uuid.Must(uuid.NewV4()),
+		UserID:    userID,
+		Kind:      kind,
+		Status:    jobPending,
+		CreatedAt: time.Now(),
+	}
+	_, err := d.db.Exec(
+		`INSERT INTO showcash.account_job (
+			id,
+			user_id,
+			kind,
+			status,
+			created_at
+		) VALUES (
+			$1, $2, $3, $4, $5
+		)`, j.ID, j.UserID, j.Kind, j.Status, j.CreatedAt,
+	)
+	return j, err
+}
+
+func (d *DAO) getAccountJob(jobID uuid.UUID) (AccountJob, error) {
+	j := AccountJob{}
+	err := d.db.Get(&j,
+		`SELECT
+			id,
+			user_id,
+			kind,
+			status,
+			error,
+			created_at,
+			finished_at
+		FROM
+			showcash.account_job
+		WHERE id = $1`, jobID,
+	)
+	return j, err
+}
+
+// getUnfinishedAccountJobs finds jobs that were cut short by a restart
+func (d *DAO) getUnfinishedAccountJobs() []AccountJob {
+	var jobs []AccountJob
+	err := d.db.Select(&jobs,
+		`SELECT
+			id,
+			user_id,
+			kind,
+			status,
+			error,
+			created_at,
+			finished_at
+		FROM
+			showcash.account_job
+		WHERE status IN ($1, $2)
+		ORDER BY created_at`, jobPending, jobRunning,
+	)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Println("getUnfinishedAccountJobs() failed", err)
+	}
+	return jobs
+}
+
+func (d *DAO) setAccountJobStatus(jobID uuid.UUID, status string, jobErr error) {
+	msg := ""
+	if jobErr != nil {
+		msg = jobErr.Error()
+	}
+	_, err := d.db.Exec(
+		`UPDATE showcash.account_job SET
+			status = $1,
+			error = $2,
+			finished_at = CASE WHEN $1 IN ('done', 'failed') THEN NOW() ELSE NULL END
+		WHERE id = $3`, status, msg, jobID,
+	)
+	if err != nil {
+		log.Println("setAccountJobStatus() failed", err)
+	}
+}
+
+func (d *DAO) recordLoginAttempt(a LoginAttempt) {
+	_, err := d.db.NamedExec(
+		`INSERT INTO showcash.login_attempt (
+			login,
+			ip,
+			user_agent,
+			user_id,
+			outcome,
+			created_at
+		) VALUES (
+			:login,
+			:ip,
+			:user_agent,
+			:user_id,
+			:outcome,
+			:created_at
+		)`, a,
+	)
+	if err != nil {
+		log.Println("recordLoginAttempt() failed", err)
+	}
+}
+
+// getUserIDByLogin is who a handle or email address logs in as, ignoring
+// case like the logins themselves
+func (d *DAO) getUserIDByLogin(login string) (uuid.UUID, error) {
+	var userID uuid.UUID
+	err := d.db.Get(&userID,
+		`SELECT user_id FROM showcash.user
+		WHERE lower(username) = lower($1) OR lower(email_address) = lower($1)`, login,
+	)
+	return userID, err
+}
+
+// takeLoginAttempt counts an attempt against key as a failure before it's
+// checked, returning the failures before it since since and when the last
+// of them was. It's one statement so parallel attempts can't all read the
+// count before any of them adds to it.
+func (d *DAO) takeLoginAttempt(key string, since time.Time) (int, time.Time, error) {
+	var result struct {
+		Failures int         `json:"failures"`
+		Last     pq.NullTime `json:"last"`
+	}
+	err := d.db.Get(&result,
+		`INSERT INTO showcash.login_throttle AS t (key, failures, last_failure)
+		VALUES ($1, 1, NOW())
+		ON CONFLICT (key) DO UPDATE SET
+			failures = CASE WHEN t.last_failure > $2 THEN t.failures + 1 ELSE 1 END,
+			previous_failure = CASE WHEN t.last_failure > $2 THEN t.last_failure END,
+			last_failure = NOW()
+		RETURNING failures - 1 AS failures, previous_failure AS last`, key, since,
+	)
+	return result.Failures, result.Last.Time, err
+}
+
+// refundLoginAttempt takes back an attempt that wasn't a failure after all
+func (d *DAO) refundLoginAttempt(key string) {
+	_, err := d.db.Exec(
+		`UPDATE showcash.login_throttle SET
+			failures = failures - 1,
+			last_failure = COALESCE(previous_failure, last_failure)
+		WHERE key = $1 AND failures > 0`, key,
+	)
+	if err != nil {
+		log.Println("refundLoginAttempt() failed", err)
+	}
+}
+
+// clearLoginFailures forgets key's failures after a good login
+func (d *DAO) clearLoginFailures(key string) {
+	if _, err := d.db.Exec(`DELETE FROM showcash.login_throttle WHERE key = $1`, key); err != nil {
+		log.Println("clearLoginFailures() failed", err)
+	}
+}
+
+// pruneLoginAttempts drops attempts from before before and throttles
+// nobody has failed since idleSince
+func (d *DAO) pruneLoginAttempts(before, idleSince time.Time) error {
+	if _, err := d.db.Exec(`DELETE FROM showcash.login_attempt WHERE created_at < $1`, before); err != nil {
+		return err
+	}
+	_, err := d.db.Exec(`DELETE FROM showcash.login_throttle WHERE last_failure < $1`, idleSince)
+	return err
+}
+
+// getTOTP returns the user's TOTP secret and whether it's been confirmed
+func (d *DAO) getTOTP(userID uuid.UUID) (string, bool, error) {
+	var result struct {
+		Secret  string `json:"totp_secret"`
+		Enabled bool   `json:"totp_enabled"`
+	}
+	err := d.db.Get(&result,
+		`SELECT totp_secret, totp_enabled FROM showcash.user WHERE user_id = $1`, userID,
+	)
+	return result.Secret, result.Enabled, err
+}
+
+// setTOTPSecret starts enrolment, it won't replace a confirmed secret
+func (d *DAO) setTOTPSecret(userID uuid.UUID, secret string) (bool, error) {
+	res, err := d.db.Exec(
+		`UPDATE showcash.user SET
+			totp_secret = $1,
+			totp_last_step = 0
+		WHERE user_id = $2 AND NOT totp_enabled`, secret, userID,
+	)
+	if err != nil {
+		return false, err
+	}
+	cnt, err := res.RowsAffected()
+	return cnt > 0, err
+}
+
+// useTOTPStep records a code as used, returning false if that code (or a
+// later one) has been used already
+func (d *DAO) useTOTPStep(userID uuid.UUID, step int64) bool {
+	res, err := d.db.Exec(
+		`UPDATE showcash.user SET totp_last_step = $1
+		WHERE user_id = $2 AND totp_last_step < $1`, step, userID,
+	)
+	if err != nil {
+		log.Println("useTOTPStep() failed", err)
+		return false
+	}
+	cnt, err := res.RowsAffected()
+	return err == nil && cnt > 0
+}
+
+// enableTOTP confirms enrolment and replaces any old recovery codes
+func (d *DAO) enableTOTP(userID uuid.UUID, recoveryHashes []string) error {
+	tx, err := d.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(
+		`UPDATE showcash.user SET totp_enabled = TRUE WHERE user_id = $1 AND totp_secret != ''`,
+		userID,
+	); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM showcash.recovery_code WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(
+		`INSERT INTO showcash.recovery_code (user_id, code_hash)
+			SELECT $1, UNNEST($2::TEXT[])`,
+		userID, pq.Array(recoveryHashes),
+	); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (d *DAO) disableTOTP(userID uuid.UUID) error {
+	tx, err := d.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(
+		`UPDATE showcash.user SET
+			totp_secret = '',
+			totp_enabled = FALSE,
+			totp_last_step = 0
+		WHERE user_id = $1`, userID,
+	); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM showcash.recovery_code WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// useRecoveryCode burns a recovery code, returning false if it wasn't
+// one of theirs or was already used
+func (d *DAO) useRecoveryCode(userID uuid.UUID, codeHash string) bool {
+	res, err := d.db.Exec(
+		`UPDATE showcash.recovery_code SET used_at = NOW()
+		WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL`, userID, codeHash,
+	)
+	if err != nil {
+		log.Println("useRecoveryCode() failed", err)
+		return false
+	}
+	cnt, err := res.RowsAffected()
+	return err == nil && cnt > 0
+}
+
+func (d *DAO) getOAuthIdentity(provider, subject string) (uuid.UUID, error) {
+	var userID uuid.UUID
+	err := d.db.Get(&userID,
+		`SELECT user_id FROM showcash.oauth_identity WHERE provider = $1 AND subject = $2`,
+		provider, subject,
+	)
+	return userID, err
+}
+
+const linkOAuthIdentitySQL = `
+		INSERT INTO showcash.oauth_identity (
+			provider,
+			subject,
+			user_id,
+			email_address
+		) VALUES (
+			$1, $2, $3, $4
+		)`
+
+func (d *DAO) linkOAuthIdentity(provider, subject string, userID uuid.UUID, email string) error {
+	_, err := d.db.Exec(linkOAuthIdentitySQL, provider, subject, userID, email)
+	return err
+}
+
+// createOAuthUser creates the account for a new provider login and links
+// it in one go, so a second signup with the same login fails instead of
+// leaving an account nobody can log in to
+func (d *DAO) createOAuthUser(u User, provider, subject, email string) (User, error) {
+	u.UserID = uuid.Must(uuid.NewV4())
+	tx, err := d.db.Beginx()
+	if err != nil {
+		return u, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.NamedExec(createUserSQL, u); err != nil {
+		return u, err
+	}
+	if _, err := tx.Exec(linkOAuthIdentitySQL, provider, subject, u.UserID, email); err != nil {
+		return u, err
+	}
+	return u, tx.Commit()
+}
+
+func (d *DAO) createAPIToken(t APIToken, tokenHash string) (APIToken, error) {
+	t.ID = uuid.Must(uuid.NewV4())
+	t.CreatedAt = time.Now()
+	_, err := d.db.Exec(
+		`INSERT INTO showcash.api_token (
+			id,
+			user_id,
+			token_hash,
+			name,
+			prefix,
+			scopes,
+			created_at
+		) VALUES (
+			$1, $2, $3, $4, $5, $6, $7
+		)`, t.ID, t.UserID, tokenHash, t.Name, t.Prefix, t.Scopes, t.CreatedAt,
+	)
+	return t, err
+}
+
+func (d *DAO) getAPITokens(userID uuid.UUID) []APIToken {
+	tokens := []APIToken{}
+	err := d.db.Select(&tokens,
+		`SELECT
+			id,
+			user_id,
+			name,
+			prefix,
+			scopes,
+			created_at,
+			last_used_at
+		FROM
+			showcash.api_token
+		WHERE user_id = $1 AND revoked_at IS NULL
+		ORDER BY created_at DESC`, userID,
+	)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Println("getAPITokens() failed", err)
+	}
+	return tokens
+}
+
+// useAPIToken finds the live token with tokenHash and the user it belongs
+// to, noting that it's been used
+func (d *DAO) useAPIToken(tokenHash string) (APIToken, User, error) {
+	var result struct {
+		APIToken
+		Username     string `json:"username"`
+		EmailAddress string `json:"email_address"`
+	}
+	err := d.db.Get(&result,
+		`UPDATE showcash.api_token AS t SET
+			last_used_at = NOW()
+		FROM showcash.user AS u
+		WHERE t.token_hash = $1 AND t.revoked_at IS NULL AND u.user_id = t.user_id
+		RETURNING
+			t.id,
+			t.user_id,
+			t.name,
+			t.prefix,
+			t.scopes,
+			t.created_at,
+			t.last_used_at,
+			u.username,
+			u.email_address`, tokenHash,
+	)
+	return result.APIToken, User{
+		UserID:       result.UserID,
+		Username:     result.Username,
+		EmailAddress: result.EmailAddress,
+	}, err
+}
+
+func (d *DAO) revokeAPIToken(userID, tokenID uuid.UUID) error {
+	res, err := d.db.Exec(
+		`UPDATE showcash.api_token SET revoked_at = NOW()
+		WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL`, tokenID, userID,
+	)
+	if err != nil {
+		return err
+	}
+	if cnt, err := res.RowsAffected(); err != nil || cnt == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
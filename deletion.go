@@ -0,0 +1,137 @@
+package showcash
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"path/filepath"
+
+	"github.com/gofrs/uuid"
+	"github.com/gorilla/mux"
+)
+
+// Kinds and states of AccountJob
+const (
+	jobDeleteAccount = "delete"
+
+	jobPending = "pending"
+	jobRunning = "running"
+	jobDone    = "done"
+	jobFailed  = "failed"
+)
+
+// runAccountJob does the work for a job, recording how it went
+func (c *Core) runAccountJob(j AccountJob) {
+	c.dao.setAccountJobStatus(j.ID, jobRunning, nil)
+
+	var err error
+	switch j.Kind {
+	case jobDeleteAccount:
+		err = c.deleteAccount(j.UserID)
+	default:
+		err = errors.New("unknown job kind " + j.Kind)
+	}
+
+	if err != nil {
+		log.Println("runAccountJob() failed", j.ID, err)
+		c.dao.setAccountJobStatus(j.ID, jobFailed, err)
+		return
+	}
+	c.dao.setAccountJobStatus(j.ID, jobDone, nil)
+}
+
+// startAccountJob runs a job in the background, shutdown waits for it
+func (c *Core) startAccountJob(j AccountJob) {
+	c.jobs.Add(1)
+	go func() {
+		defer c.jobs.Done()
+		c.runAccountJob(j)
+	}()
+}
+
+// resumeAccountJobs picks up anything a restart interrupted. Deleting an
+// account is safe to run twice.
+func (c *Core) resumeAccountJobs() {
+	for _, j := range c.dao.getUnfinishedAccountJobs() {
+		c.startAccountJob(j)
+	}
+}
+
+// deleteAccount removes the user's rows then their images
+func (c *Core) deleteAccount(userID uuid.UUID) error {
+	images, err := c.dao.deleteAccount(userID)
+	if err != nil {
+		return err
+	}
+	for _, uri := range images {
+		if avatarName.MatchString(filepath.Base(uri)) {
+			c.removeAvatar(uri) // and the smaller renditions
+			continue
+		}
+		if err := c.removeImage(uri); err != nil {
+			log.Println("deleteAccount().removeImage failed", err)
+		}
+	}
+	return nil
+}
+
+func (c *Core) apiDeleteAccount(wr http.ResponseWriter, req *http.Request) {
+	u := GetSessionFromContext(req)
+	if u == nil {
+		apiUnauthorizedError.write(wr)
+		return
+	}
+
+	payload := struct {
+		Password string `json:"password"`
+	}{}
+	if err := json.NewDecoder(req.Body).Decode(&payload); err != nil {
+		log.Println("apiDeleteAccount.Decode() failed", err)
+		apiBadJSONError.write(wr)
+		return
+	}
+	if !c.dao.checkPassword(u.UserID, payload.Password) {
+		apiWrongPasswordError.write(wr)
+		return
+	}
+
+	j, err := c.dao.createAccountJob(u.UserID, jobDeleteAccount)
+	if err != nil {
+		log.Println("apiDeleteAccount().createAccountJob failed", err)
+		apiServerError.write(wr)
+		return
+	}
+	c.startAccountJob(j)
+
+	// They're on their way out, so is the session
+	clearUserCookie(wr)
+	wr.WriteHeader(http.StatusAccepted)
+	if err := json.NewEncoder(wr).Encode(j); err != nil {
+		log.Printf("Error Encoding JSON: %s", err)
+	}
+}
+
+// apiGetAccountJob reports on a job. The account may be gone by now so
+// knowing the job ID is all it takes.
+func (c *Core) apiGetAccountJob(wr http.ResponseWriter, req *http.Request) {
+	jobID := uuid.FromStringOrNil(mux.Vars(req)["guid"])
+	if jobID == uuid.Nil {
+		apiNotFoundError.write(wr)
+		return
+	}
+
+	j, err := c.dao.getAccountJob(jobID)
+	if errors.Is(err, sql.ErrNoRows) {
+		apiNotFoundError.write(wr)
+		return
+	} else if err != nil {
+		log.Println("apiGetAccountJob().getAccountJob failed", err)
+		apiServerError.write(wr)
+		return
+	}
+	if err := json.NewEncoder(wr).Encode(j); err != nil {
+		log.Printf("Error Encoding JSON: %s", err)
+	}
+}
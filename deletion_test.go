@@ -0,0 +1,39 @@
+package showcash
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemStore_deleteAccountForgetsLogins(t *testing.T) {
+	store := NewMemStore()
+	nick := newTestUser(t, store, "Nick")
+	kim := newTestUser(t, store, "Kim")
+	if err := store.changeUsername(nick.UserID, "Nicky", 0, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	for _, a := range []LoginAttempt{
+		{Login: "nicky", Outcome: loginOK, UserID: &nick.UserID},
+		{Login: "nick", Outcome: loginBadCreds},
+		{Login: "nick@example.com", Outcome: loginBadCreds},
+		{Login: "kim", Outcome: loginOK, UserID: &kim.UserID},
+	} {
+		a.CreatedAt = now
+		store.recordLoginAttempt(a)
+	}
+	for _, key := range []string{userLoginKey(nick.UserID), "login:nicky", userLoginKey(kim.UserID)} {
+		store.takeLoginAttempt(key, now.Add(-time.Hour))
+	}
+
+	if _, err := store.deleteAccount(nick.UserID); err != nil {
+		t.Fatal(err)
+	}
+	if len(store.loginAttempts) != 1 || store.loginAttempts[0].Login != "kim" {
+		t.Errorf("login attempts left after deleting Nick = %+v", store.loginAttempts)
+	}
+	if len(store.loginThrottle) != 1 || store.loginThrottle[userLoginKey(kim.UserID)] == nil {
+		t.Errorf("throttles left after deleting Nick = %v", store.loginThrottle)
+	}
+}
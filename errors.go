@@ -19,17 +19,38 @@ var (
 	errNotAuthorized  = fmt.Errorf("unauthorized")
 )
 
-func jsonResponse(wr http.ResponseWriter, message string, code int) {
-	wr.WriteHeader(code)
-	if err := json.NewEncoder(wr).Encode(struct {
-		Message string
-	}{
-		Message: message,
-	}); err != nil {
+// withMessage is the same response with a more helpful message
+func (r apiSimpleResponse) withMessage(message string) apiSimpleResponse {
+	r.Message = message
+	return r
+}
+
+// withCode is the same response with a more specific code
+func (r apiSimpleResponse) withCode(code string) apiSimpleResponse {
+	r.Code = code
+	return r
+}
+
+// write sends the response with its status code
+func (r apiSimpleResponse) write(wr http.ResponseWriter) {
+	wr.Header().Set("Content-Type", "application/json")
+	wr.WriteHeader(r.statusCode)
+	if err := json.NewEncoder(wr).Encode(r); err != nil {
 		log.Println("Failed to write err:", err)
 	}
 }
 
+// validationResponse lists every field that failed validation
+func validationResponse(wr http.ResponseWriter, err error) {
+	fe := fieldErrors{}
+	if !errors.As(err, &fe) {
+		fe.add("", err.Error())
+	}
+	resp := apiInvalidFieldsError
+	resp.Errors = fe
+	resp.write(wr)
+}
+
 // Database errors as needed
 var (
 	errNotUnique = errors.New("Violated a unique constraint")
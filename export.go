@@ -0,0 +1,91 @@
+package showcash
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// exportImages lists every image we're holding for the export
+func exportImages(ex AccountExport) []string {
+	images := []string{}
+	if ex.User.ProfileURI != "" {
+		images = append(images, ex.User.ProfileURI)
+	}
+	for _, p := range ex.Posts {
+		if p.ImageURI != "" {
+			images = append(images, p.ImageURI)
+		}
+	}
+	return images
+}
+
+// writeExportZip bundles the export up as one JSON file per section
+func writeExportZip(wr http.ResponseWriter, ex AccountExport) error {
+	zw := zip.NewWriter(wr)
+	files := []struct {
+		name string
+		v    interface{}
+	}{
+		{"profile.json", struct {
+			ExportedAt time.Time   `json:"exported_at"`
+			User       User        `json:"user"`
+			Profile    UserProfile `json:"profile"`
+		}{ex.ExportedAt, ex.User, ex.Profile}},
+		{"posts.json", ex.Posts},
+		{"comments.json", ex.Comments},
+		{"images.json", ex.Images},
+	}
+	for _, f := range files {
+		w, err := zw.CreateHeader(&zip.FileHeader{
+			Name:     f.name,
+			Method:   zip.Deflate,
+			Modified: ex.ExportedAt,
+		})
+		if err != nil {
+			return err
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(f.v); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// apiGetExport hands the user a copy of everything we hold about them, as
+// a zip by default or as one JSON document with ?format=json
+func (c *Core) apiGetExport(wr http.ResponseWriter, req *http.Request) {
+	u := GetSessionFromContext(req)
+	if u == nil {
+		apiUnauthorizedError.write(wr)
+		return
+	}
+
+	ex, err := c.dao.getAccountExport(u.UserID)
+	if err != nil {
+		log.Println("apiGetExport().getAccountExport failed", err)
+		apiServerError.write(wr)
+		return
+	}
+	ex.Images = exportImages(ex)
+
+	name := fmt.Sprintf("showcash-%s-%s", ex.User.Username, ex.ExportedAt.Format("20060102"))
+	if req.URL.Query().Get("format") == "json" {
+		wr.Header().Set("Content-Disposition", `attachment; filename="`+name+`.json"`)
+		if err := json.NewEncoder(wr).Encode(ex); err != nil {
+			log.Printf("Error Encoding JSON: %s", err)
+		}
+		return
+	}
+
+	wr.Header().Set("Content-Type", "application/zip")
+	wr.Header().Set("Content-Disposition", `attachment; filename="`+name+`.zip"`)
+	if err := writeExportZip(wr, ex); err != nil {
+		log.Println("apiGetExport().writeExportZip failed", err)
+	}
+}
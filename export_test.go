@@ -0,0 +1,63 @@
+package showcash
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_writeExportZip(t *testing.T) {
+	ex := AccountExport{
+		ExportedAt: time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC),
+		User:       User{Username: "nick", ProfileURI: "https://images.showcash.io/avatar.jpg"},
+		Posts: []Post{
+			{Title: "desk", ImageURI: "https://images.showcash.io/desk.jpg", ItemList: []Item{{Title: "lamp"}}},
+			{Title: "no image"},
+		},
+		Comments: []Comment{{Comment: "nice"}},
+	}
+	ex.Images = exportImages(ex)
+	wantImages := []string{"https://images.showcash.io/avatar.jpg", "https://images.showcash.io/desk.jpg"}
+	if !reflect.DeepEqual(ex.Images, wantImages) {
+		t.Errorf("exportImages() = %v, want %v", ex.Images, wantImages)
+	}
+
+	rec := httptest.NewRecorder()
+	if err := writeExportZip(rec, ex); err != nil {
+		t.Fatal(err)
+	}
+	body := rec.Body.Bytes()
+	zr, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := map[string]bool{}
+	for _, f := range zr.File {
+		got[f.Name] = true
+		if f.Name != "posts.json" {
+			continue
+		}
+		r, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var posts []Post
+		if err := json.NewDecoder(r).Decode(&posts); err != nil {
+			t.Fatal(err)
+		}
+		r.Close()
+		if len(posts) != 2 || posts[0].ItemList[0].Title != "lamp" {
+			t.Errorf("posts.json = %+v", posts)
+		}
+	}
+	for _, name := range []string{"profile.json", "posts.json", "comments.json", "images.json"} {
+		if !got[name] {
+			t.Errorf("zip is missing %s", name)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package showcash
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/gorilla/mux"
+)
+
+var errBadCursor = errors.New("bad cursor")
+
+// feedCursor is the position of the last post on a page of the feed
+type feedCursor struct {
+	Date time.Time
+	ID   uuid.UUID
+}
+
+func (fc feedCursor) String() string {
+	raw := strconv.FormatInt(fc.Date.UnixNano(), 10) + "." + fc.ID.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func parseFeedCursor(s string) (*feedCursor, error) {
+	if s == "" {
+		return nil, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errBadCursor
+	}
+	parts := strings.SplitN(string(raw), ".", 2)
+	if len(parts) != 2 {
+		return nil, errBadCursor
+	}
+	nanos, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return nil, errBadCursor
+	}
+	id, err := uuid.FromString(parts[1])
+	if err != nil {
+		return nil, errBadCursor
+	}
+	return &feedCursor{Date: time.Unix(0, nanos), ID: id}, nil
+}
+
+func (c *Core) apiGetFeed(wr http.ResponseWriter, req *http.Request) {
+	u := GetSessionFromContext(req)
+	if u == nil {
+		apiUnauthorizedError.write(wr)
+		return
+	}
+
+	cursor, err := parseFeedCursor(req.URL.Query().Get("cursor"))
+	if err != nil {
+		apiBadRequestError.withCode("bad_cursor").withMessage("Bad cursor").write(wr)
+		return
+	}
+	limit, _ := pageParams(req)
+
+	page := FeedPage{}
+	if cursor == nil && !c.dao.hasFollows(u.UserID) {
+		page.Posts = c.dao.getMostViewedPosts()
+		page.Trending = true
+	} else {
+		page.Posts = c.dao.getFeed(u.UserID, cursor, limit)
+		if len(page.Posts) == limit {
+			last := page.Posts[len(page.Posts)-1]
+			page.NextCursor = feedCursor{Date: last.Date, ID: last.ID}.String()
+		}
+	}
+	if page.Posts == nil {
+		page.Posts = []Post{}
+	}
+
+	if err := json.NewEncoder(wr).Encode(page); err != nil {
+		log.Printf("Error Encoding JSON: %s", err)
+	}
+}
+
+func (c *Core) apiPostFollowTag(wr http.ResponseWriter, req *http.Request) {
+	c.setTagFollow(wr, req, true)
+}
+
+func (c *Core) apiDeleteFollowTag(wr http.ResponseWriter, req *http.Request) {
+	c.setTagFollow(wr, req, false)
+}
+
+func (c *Core) setTagFollow(wr http.ResponseWriter, req *http.Request, follow bool) {
+	u := GetSessionFromContext(req)
+	if u == nil {
+		apiUnauthorizedError.write(wr)
+		return
+	}
+
+	tags := cleanTags([]string{mux.Vars(req)["tag"]})
+	if len(tags) == 0 {
+		apiNotFoundError.write(wr)
+		return
+	}
+
+	var err error
+	if follow {
+		err = c.dao.followTags(u.UserID, tags)
+	} else {
+		err = c.dao.unfollowTags(u.UserID, tags)
+	}
+	if err != nil {
+		log.Println("setTagFollow() failed", err)
+		apiServerError.write(wr)
+		return
+	}
+	apiOK.write(wr)
+}
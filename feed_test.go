@@ -0,0 +1,28 @@
+package showcash
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+func Test_feedCursor(t *testing.T) {
+	want := feedCursor{Date: time.Date(2020, 4, 8, 15, 9, 43, 123456000, time.UTC), ID: uuid.Must(uuid.NewV4())}
+	got, err := parseFeedCursor(want.String())
+	if err != nil {
+		t.Fatal("parseFeedCursor() failed", err)
+	}
+	if !got.Date.Equal(want.Date) || got.ID != want.ID {
+		t.Errorf("parseFeedCursor() = %v, want %v", got, want)
+	}
+
+	if got, err := parseFeedCursor(""); got != nil || err != nil {
+		t.Errorf("parseFeedCursor(\"\") = %v, %v, want nil, nil", got, err)
+	}
+	for _, bad := range []string{"!!!", "bm9wZQ", "MTIz.bm9wZQ"} {
+		if _, err := parseFeedCursor(bad); err != errBadCursor {
+			t.Errorf("parseFeedCursor(%q) error = %v, want %v", bad, err, errBadCursor)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package showcash
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gofrs/uuid"
+	"github.com/gorilla/mux"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// pageParams reads ?limit= and ?offset= falling back to sane values
+func pageParams(req *http.Request) (limit, offset int) {
+	limit, err := strconv.Atoi(req.URL.Query().Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = defaultPageSize
+	}
+	if limit > maxPageSize {
+		limit = maxPageSize
+	}
+	offset, err = strconv.Atoi(req.URL.Query().Get("offset"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+	return limit, offset
+}
+
+// userIDFromHandle looks up the {handle} in the route
+func (c *Core) userIDFromHandle(req *http.Request) (uuid.UUID, error) {
+	handle := mux.Vars(req)["handle"]
+	if !isAlphaNumeric(handle) {
+		return uuid.Nil, sql.ErrNoRows
+	}
+	userID, err := c.dao.getUserIDByHandle(handle)
+	if errors.Is(err, sql.ErrNoRows) {
+		// Maybe they changed it recently
+		if current, err := c.dao.getCurrentUsername(handle); err == nil {
+			return c.dao.getUserIDByHandle(current)
+		}
+	}
+	return userID, err
+}
+
+func (c *Core) apiPostFollow(wr http.ResponseWriter, req *http.Request) {
+	u := GetSessionFromContext(req)
+	if u == nil {
+		apiUnauthorizedError.write(wr)
+		return
+	}
+
+	followeeID, err := c.userIDFromHandle(req)
+	if errors.Is(err, sql.ErrNoRows) {
+		apiNotFoundError.write(wr)
+		return
+	} else if err != nil {
+		log.Println("apiPostFollow().userIDFromHandle failed", err)
+		apiServerError.write(wr)
+		return
+	}
+	if followeeID == u.UserID {
+		apiBadRequestError.withMessage("You can't follow yourself").write(wr)
+		return
+	}
+
+	if err := c.dao.follow(u.UserID, followeeID); err != nil {
+		log.Println("apiPostFollow().follow failed", err)
+		apiServerError.write(wr)
+		return
+	}
+	apiOK.write(wr)
+}
+
+func (c *Core) apiDeleteFollow(wr http.ResponseWriter, req *http.Request) {
+	u := GetSessionFromContext(req)
+	if u == nil {
+		apiUnauthorizedError.write(wr)
+		return
+	}
+
+	followeeID, err := c.userIDFromHandle(req)
+	if errors.Is(err, sql.ErrNoRows) {
+		apiNotFoundError.write(wr)
+		return
+	} else if err != nil {
+		log.Println("apiDeleteFollow().userIDFromHandle failed", err)
+		apiServerError.write(wr)
+		return
+	}
+
+	if err := c.dao.unfollow(u.UserID, followeeID); err != nil {
+		log.Println("apiDeleteFollow().unfollow failed", err)
+		apiServerError.write(wr)
+		return
+	}
+	apiOK.write(wr)
+}
+
+func (c *Core) apiGetFollowers(wr http.ResponseWriter, req *http.Request) {
+	userID, err := c.userIDFromHandle(req)
+	if err != nil {
+		apiNotFoundError.write(wr)
+		return
+	}
+
+	limit, offset := pageParams(req)
+	result := c.dao.getFollowers(userID, limit, offset)
+	if err := json.NewEncoder(wr).Encode(result); err != nil {
+		log.Printf("Error Encoding JSON: %s", err)
+	}
+}
+
+func (c *Core) apiGetFollowing(wr http.ResponseWriter, req *http.Request) {
+	userID, err := c.userIDFromHandle(req)
+	if err != nil {
+		apiNotFoundError.write(wr)
+		return
+	}
+
+	limit, offset := pageParams(req)
+	result := c.dao.getFollowing(userID, limit, offset)
+	if err := json.NewEncoder(wr).Encode(result); err != nil {
+		log.Printf("Error Encoding JSON: %s", err)
+	}
+}
@@ -0,0 +1,125 @@
+package showcash
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func Test_pageParams(t *testing.T) {
+	tests := []struct {
+		query      string
+		wantLimit  int
+		wantOffset int
+	}{
+		{"", defaultPageSize, 0},
+		{"limit=5&offset=10", 5, 10},
+		{"limit=0", defaultPageSize, 0},
+		{"limit=-1&offset=-3", defaultPageSize, 0},
+		{"limit=1000", maxPageSize, 0},
+		{"limit=ten&offset=two", defaultPageSize, 0},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/api/profile/nick/followers?"+tt.query, nil)
+		if limit, offset := pageParams(req); limit != tt.wantLimit || offset != tt.wantOffset {
+			t.Errorf("pageParams(%q) = %d, %d want %d, %d", tt.query, limit, offset, tt.wantLimit, tt.wantOffset)
+		}
+	}
+}
+
+func TestCore_HandlerFollows(t *testing.T) {
+	store, srv, nick := newTestServer(t)
+	defer srv.Close()
+	for _, name := range []string{"Kim", "Lee", "Pat", "Sam", "Alex"} {
+		newTestUser(t, store, name)
+	}
+	followers := func(handle string) []UserProfile {
+		page := []UserProfile{}
+		if got := nick.do(http.MethodGet, "/api/profile/"+handle+"/followers", nil, &page); got != http.StatusOK {
+			t.Fatalf("followers of %s = %d", handle, got)
+		}
+		return page
+	}
+
+	tests := []struct {
+		name          string
+		method        string
+		handle        string
+		want          int
+		wantFollowers int // Kim's afterwards
+	}{
+		{"yourself", http.MethodPost, "Nick", http.StatusBadRequest, 0},
+		{"nobody", http.MethodPost, "nobody", http.StatusNotFound, 0},
+		{"not a handle", http.MethodPost, "no.body", http.StatusNotFound, 0},
+		{"unfollowing before following", http.MethodDelete, "Kim", http.StatusOK, 0},
+		{"follow", http.MethodPost, "Kim", http.StatusOK, 1},
+		{"follow twice", http.MethodPost, "Kim", http.StatusOK, 1},
+		{"unfollow", http.MethodDelete, "Kim", http.StatusOK, 0},
+		{"unfollow twice", http.MethodDelete, "Kim", http.StatusOK, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := nick.do(tt.method, "/api/follow/"+tt.handle, nil, nil); got != tt.want {
+				t.Errorf("%s %s = %d, want %d", tt.method, tt.handle, got, tt.want)
+			}
+			if got := followers("Kim"); len(got) != tt.wantFollowers {
+				t.Errorf("Kim has %d followers, want %d", len(got), tt.wantFollowers)
+			}
+		})
+	}
+
+	// Old handles still work for a while
+	kim, _ := store.getUserIDByHandle("Kim")
+	if err := store.changeUsername(kim, "Kimberly", 0, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if got := nick.do(http.MethodPost, "/api/follow/Kim", nil, nil); got != http.StatusOK {
+		t.Errorf("following by an old handle = %d", got)
+	}
+	if got := followers("Kimberly"); len(got) != 1 || got[0].Username != "Nick" {
+		t.Errorf("followers after following by an old handle = %+v", got)
+	}
+
+	// Pages are most recent first
+	for _, handle := range []string{"Lee", "Pat", "Sam", "Alex"} {
+		if got := nick.do(http.MethodPost, "/api/follow/"+handle, nil, nil); got != http.StatusOK {
+			t.Fatalf("following %s = %d", handle, got)
+		}
+	}
+	pages := []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{"Alex", "Sam", "Pat", "Lee", "Kimberly"}},
+		{"?limit=2", []string{"Alex", "Sam"}},
+		{"?limit=2&offset=2", []string{"Pat", "Lee"}},
+		{"?limit=2&offset=4", []string{"Kimberly"}},
+		{"?offset=10", []string{}},
+	}
+	for _, p := range pages {
+		page := []UserProfile{}
+		if got := nick.do(http.MethodGet, "/api/profile/Nick/following"+p.query, nil, &page); got != http.StatusOK {
+			t.Fatalf("following%s = %d", p.query, got)
+		}
+		var names []string
+		for _, up := range page {
+			names = append(names, up.Username)
+		}
+		if fmt.Sprint(names) != fmt.Sprint(p.want) {
+			t.Errorf("following%s = %v, want %v", p.query, names, p.want)
+		}
+	}
+
+	// Hidden accounts drop out of the counts as well as the lists
+	sam, _ := store.getUserIDByHandle("Sam")
+	store.user(sam).hidden = true
+	profile := UserProfile{}
+	if got := nick.do(http.MethodGet, "/api/profile/Nick", nil, &profile); got != http.StatusOK {
+		t.Fatalf("profile = %d", got)
+	}
+	if profile.FollowingCount != 4 || len(profile.Friends) != 4 {
+		t.Errorf("following %d, listing %d after hiding Sam, want 4 and 4", profile.FollowingCount, len(profile.Friends))
+	}
+}
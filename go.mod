@@ -15,4 +15,5 @@ require (
 	github.com/joho/godotenv v1.3.0
 	github.com/lib/pq v1.3.0
 	github.com/quickaco/xerosdk v0.1.8
+	golang.org/x/text v0.3.3
 )
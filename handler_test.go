@@ -0,0 +1,291 @@
+package showcash
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCore_Handler(t *testing.T) {
+	srv := httptest.NewServer(New(NewMemStore(), WithSiteURL("https://showcash.io/")).Handler())
+	defer srv.Close()
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		headers  map[string]string
+		body     string
+		want     int
+		wantCode string // in the error body, if there should be one
+	}{
+		{"healthcheck", http.MethodGet, "/healthcheck", nil, "", http.StatusOK, ""},
+		{"needs a session", http.MethodGet, "/api/profile", nil, "", http.StatusUnauthorized, "unauthorized"},
+		{"tokens aren't for everything", http.MethodPut, "/api/profile/password", map[string]string{"Authorization": "Bearer sc_abc"}, "", http.StatusForbidden, "token_not_allowed"},
+		{"revoked token", http.MethodGet, "/api/profile", map[string]string{"Authorization": "Bearer sc_abc"}, "", http.StatusUnauthorized, "bad_token"},
+		{"cross site post", http.MethodPost, "/api/me", map[string]string{"Origin": "https://evil.example", "Cookie": "showcash=x"}, "", http.StatusForbidden, "csrf"},
+		{"bad json", http.MethodPost, "/auth/login", nil, "{", http.StatusBadRequest, "bad_json"},
+		{"bad signup", http.MethodPost, "/auth/register", nil, `{"username": "no spaces"}`, http.StatusBadRequest, "invalid_fields"},
+		{"unknown post", http.MethodGet, "/api/me/8b1c5e3e-9d2f-4c7a-a0b1-2f3e4d5c6b7a", nil, "", http.StatusNotFound, "not_found"},
+		{"unknown profile", http.MethodGet, "/api/profile/nobody", nil, "", http.StatusNotFound, "not_found"},
+		{"unknown oauth provider", http.MethodGet, "/auth/oauth/myspace", nil, "", http.StatusNotFound, "not_found"},
+		{"unknown route", http.MethodGet, "/api/nope", nil, "", http.StatusNotFound, "not_found"},
+		{"wrong method", http.MethodPatch, "/api/recent", nil, "", http.StatusMethodNotAllowed, "method_not_allowed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, srv.URL+tt.path, strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			resp, err := srv.Client().Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tt.want {
+				t.Errorf("%s %s = %d, want %d", tt.method, tt.path, resp.StatusCode, tt.want)
+			}
+			if tt.wantCode == "" {
+				return
+			}
+			got := apiSimpleResponse{}
+			if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+				t.Fatal("error body isn't JSON", err)
+			}
+			if got.Code != tt.wantCode || got.Message == "" {
+				t.Errorf("%s %s body = %+v, want code %q", tt.method, tt.path, got, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestCore_HandlerPreflight(t *testing.T) {
+	cors := DefaultCORSConfig()
+	cors.AllowedOrigins = []string{"https://*.showcash.io"}
+	h := New(NewMemStore(), WithCORS(cors)).Handler()
+
+	req := httptest.NewRequest(http.MethodOptions, "/api/me", nil)
+	req.Header.Set("Origin", "https://preview.showcash.io")
+	req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || rec.Header().Get("Access-Control-Allow-Origin") != "https://preview.showcash.io" {
+		t.Errorf("preflight got %d %v", rec.Code, rec.Header())
+	}
+}
+
+// testMailer keeps what would have been emailed so tests can follow links
+type testMailer struct {
+	mu   sync.Mutex
+	sent map[string][]string // bodies by address, oldest first
+}
+
+func (m *testMailer) Send(to, subject, body string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.sent == nil {
+		m.sent = map[string][]string{}
+	}
+	m.sent[to] = append(m.sent[to], body)
+	return nil
+}
+
+var linkToken = regexp.MustCompile(`token=(\S+)`)
+
+// token is the one in the last link sent to, waiting a moment for mail
+// that goes out in the background. It's empty if nothing turned up.
+func (m *testMailer) token(to string) string {
+	for wait := time.Now().Add(time.Second); time.Now().Before(wait); time.Sleep(10 * time.Millisecond) {
+		m.mu.Lock()
+		bodies := m.sent[to]
+		m.mu.Unlock()
+		for i := len(bodies) - 1; i >= 0; i-- {
+			if match := linkToken.FindStringSubmatch(bodies[i]); match != nil {
+				token, _ := url.QueryUnescape(match[1])
+				return token
+			}
+		}
+	}
+	return ""
+}
+
+// testPassword is every test user's password
+const testPassword = "correct horse"
+
+// newTestServer is the API on a fresh MemStore with Nick signed up and
+// logged in, which is where most handler tests start. The caller closes
+// the server.
+func newTestServer(t *testing.T, opts ...Option) (*MemStore, *httptest.Server, *apiClient) {
+	store := NewMemStore()
+	srv := httptest.NewServer(New(store, opts...).Handler())
+	nick := newLoggedInClient(t, srv, newTestUser(t, store, "Nick"))
+	return store, srv, nick
+}
+
+// newTestUser adds name to store with an example.com address and
+// testPassword
+func newTestUser(t *testing.T, store *MemStore, name string) User {
+	u, err := store.createUser(User{Username: name, EmailAddress: strings.ToLower(name) + "@example.com", Password: testPassword})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+// newLoggedInClient is a client with its own session as u
+func newLoggedInClient(t *testing.T, srv *httptest.Server, u User) *apiClient {
+	a := newAPIClient(t, srv)
+	if got := a.do(http.MethodPost, "/auth/login", map[string]string{"username": u.Username, "password": testPassword}, nil); got != http.StatusOK {
+		t.Fatalf("login as %s = %d", u.Username, got)
+	}
+	a.user = u
+	return a
+}
+
+// apiClient talks to the API like the frontend does, cookies and all
+type apiClient struct {
+	t      *testing.T
+	srv    *httptest.Server
+	client *http.Client
+	token  string
+	user   User // who it logged in as, if anyone
+}
+
+func newAPIClient(t *testing.T, srv *httptest.Server) *apiClient {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// srv.Client() is shared, each client needs its own cookies
+	client := &http.Client{Transport: srv.Client().Transport, Jar: jar}
+	return &apiClient{t: t, srv: srv, client: client}
+}
+
+// do sends body as JSON and decodes the response into out, if given
+func (a *apiClient) do(method, path string, body, out interface{}) int {
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			a.t.Fatal(err)
+		}
+		r = strings.NewReader(string(b))
+	}
+	req, err := http.NewRequest(method, a.srv.URL+path, r)
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	req.Header.Set("Origin", "https://showcash.io")
+	if a.token != "" {
+		req.Header.Set("Authorization", "Bearer "+a.token)
+	}
+	resp, err := a.client.Do(req)
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			a.t.Fatalf("%s %s: decoding response: %v", method, path, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func TestCore_HandlerAccountFlow(t *testing.T) {
+	srv := httptest.NewServer(New(NewMemStore()).Handler())
+	defer srv.Close()
+	nick := newAPIClient(t, srv)
+
+	signup := User{Username: "Nick", EmailAddress: "nick@example.com", Password: testPassword}
+	if got := nick.do(http.MethodPost, "/auth/register", signup, nil); got != http.StatusOK {
+		t.Fatalf("register = %d", got)
+	}
+	profile := UserProfile{}
+	if got := nick.do(http.MethodGet, "/api/profile", nil, &profile); got != http.StatusOK || profile.Username != "Nick" {
+		t.Fatalf("profile after register = %d %+v", got, profile)
+	}
+	if got := newAPIClient(t, srv).do(http.MethodPost, "/auth/register", signup, nil); got != http.StatusConflict {
+		t.Errorf("registering twice = %d, want %d", got, http.StatusConflict)
+	}
+	for _, clash := range []User{
+		{Username: "NICK", EmailAddress: "nick2@example.com", Password: testPassword},
+		{Username: "Nick2", EmailAddress: "Nick@Example.com", Password: testPassword},
+	} {
+		if got := newAPIClient(t, srv).do(http.MethodPost, "/auth/register", clash, nil); got != http.StatusConflict {
+			t.Errorf("registering %s <%s> = %d, want %d", clash.Username, clash.EmailAddress, got, http.StatusConflict)
+		}
+	}
+
+	// Logging in again from somewhere else
+	other := newAPIClient(t, srv)
+	bad := map[string]string{"username": "nick", "password": "wrong"}
+	failed := apiSimpleResponse{}
+	if got := other.do(http.MethodPost, "/auth/login", bad, &failed); got != http.StatusUnauthorized || failed.Code != "bad_credentials" {
+		t.Errorf("login with the wrong password = %d %+v, want %d", got, failed, http.StatusUnauthorized)
+	}
+	good := map[string]string{"username": "NICK@example.com", "password": testPassword}
+	user := User{}
+	if got := other.do(http.MethodPost, "/auth/login", good, &user); got != http.StatusOK || user.Username != "Nick" || user.Password != "" {
+		t.Fatalf("login = %d %+v", got, user)
+	}
+
+	token := APIToken{}
+	ask := APIToken{Name: "backup script", Scopes: []string{scopeProfileRead}}
+	if got := other.do(http.MethodPost, "/api/profile/tokens", ask, &token); got != http.StatusCreated || !strings.HasPrefix(token.Token, apiTokenPrefix) {
+		t.Fatalf("making a token = %d %+v", got, token)
+	}
+
+	script := newAPIClient(t, srv)
+	script.token = token.Token
+	if got := script.do(http.MethodGet, "/api/profile", nil, nil); got != http.StatusOK {
+		t.Errorf("reading the profile with a token = %d", got)
+	}
+	if got := script.do(http.MethodPut, "/api/profile", User{Bio: "hi"}, nil); got != http.StatusForbidden {
+		t.Errorf("writing the profile with a read token = %d, want %d", got, http.StatusForbidden)
+	}
+	if got := other.do(http.MethodDelete, "/api/profile/tokens/"+token.ID.String(), nil, nil); got != http.StatusOK {
+		t.Errorf("revoking the token = %d", got)
+	}
+	if got := script.do(http.MethodGet, "/api/profile", nil, nil); got != http.StatusUnauthorized {
+		t.Errorf("using a revoked token = %d, want %d", got, http.StatusUnauthorized)
+	}
+}
+
+func TestCore_HandlerPasswordChangeRevokesTokens(t *testing.T) {
+	_, srv, nick := newTestServer(t)
+	defer srv.Close()
+
+	token := APIToken{}
+	if got := nick.do(http.MethodPost, "/api/profile/tokens", APIToken{Name: "script", Scopes: []string{scopeProfileRead}}, &token); got != http.StatusCreated {
+		t.Fatalf("making a token = %d", got)
+	}
+	script := newAPIClient(t, srv)
+	script.token = token.Token
+	if got := script.do(http.MethodGet, "/api/profile", nil, nil); got != http.StatusOK {
+		t.Fatalf("reading the profile with a token = %d", got)
+	}
+
+	change := map[string]string{"current_password": testPassword, "password": "battery staple"}
+	if got := nick.do(http.MethodPut, "/api/profile/password", change, nil); got != http.StatusOK {
+		t.Fatalf("changing the password = %d", got)
+	}
+	if got := script.do(http.MethodGet, "/api/profile", nil, nil); got != http.StatusUnauthorized {
+		t.Errorf("token after a password change = %d, want %d", got, http.StatusUnauthorized)
+	}
+	if got := nick.do(http.MethodGet, "/api/profile", nil, nil); got != http.StatusOK {
+		t.Errorf("the session that changed the password = %d, want %d", got, http.StatusOK)
+	}
+}
@@ -0,0 +1,140 @@
+package showcash
+
+import (
+	"errors"
+	"net"
+	"net/url"
+	"strings"
+)
+
+var (
+	errBadLink     = errors.New("must be a valid http or https link")
+	errBlockedLink = errors.New("links to a blocked site")
+	errBadHandle   = errors.New("must be a handle or a link to your profile")
+)
+
+// allowedSchemes keeps javascript:, data: and friends out of the links
+var allowedSchemes = map[string]bool{
+	"http":  true,
+	"https": true,
+}
+
+// affiliateParams are query parameters dropped when affiliate stripping is
+// on - anything starting with utm_ goes too
+var affiliateParams = map[string]bool{
+	"tag":          true, // Amazon
+	"ascsubtag":    true,
+	"linkcode":     true,
+	"ref":          true,
+	"ref_":         true,
+	"aff":          true,
+	"aff_id":       true,
+	"affid":        true,
+	"affiliate":    true,
+	"affiliate_id": true,
+	"clickid":      true,
+	"fbclid":       true,
+	"gclid":        true,
+	"irclickid":    true,
+}
+
+// socialProfileBases turns a bare social handle into a link, in the same
+// order as social_1, social_2 and social_3
+var socialProfileBases = [3]string{
+	"https://www.instagram.com/",
+	"https://www.facebook.com/",
+	"https://twitter.com/",
+}
+
+// canonicalLink checks a user supplied link and returns the normalised
+// version of it. Empty links are fine and stay empty.
+func canonicalLink(raw string, stripAffiliate bool) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", nil
+	}
+	if !strings.Contains(raw, "://") {
+		// People paste example.com/thing all the time
+		if i := strings.Index(raw, ":"); i >= 0 && !strings.ContainsAny(raw[:i], "./") {
+			return "", errBadLink // javascript:, data:, mailto: etc.
+		}
+		raw = "https://" + raw
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil || !allowedSchemes[strings.ToLower(u.Scheme)] {
+		return "", errBadLink
+	}
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if host == "" || (!strings.Contains(host, ".") && net.ParseIP(host) == nil) {
+		return "", errBadLink
+	}
+	for i := 0; i < len(host); i++ {
+		if !isHostByte(host[i]) && host[i] != '.' && host[i] != ':' {
+			return "", errBadLink
+		}
+	}
+	if _, blocked := contentFilter.CheckDomain(host); blocked {
+		return "", errBlockedLink
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.User = nil // user:pass@ is only ever used to disguise the real host
+	u.Fragment = ""
+	if port := u.Port(); (u.Scheme == "http" && port == "80") || (u.Scheme == "https" && port == "443") || port == "" {
+		u.Host = host
+		if strings.Contains(host, ":") {
+			u.Host = "[" + host + "]" // IPv6 keeps its brackets
+		}
+	} else {
+		u.Host = net.JoinHostPort(host, port)
+	}
+	if u.Path == "" {
+		u.Path = "/"
+	}
+
+	q := u.Query()
+	if stripAffiliate {
+		for k := range q {
+			if lk := strings.ToLower(k); affiliateParams[lk] || strings.HasPrefix(lk, "utm_") {
+				q.Del(k)
+			}
+		}
+	}
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// canonicalSocial accepts either a handle or a link to a profile for the
+// n'th (0 based) social field
+func canonicalSocial(n int, raw string, stripAffiliate bool) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", nil
+	}
+	if strings.ContainsAny(raw, "/:") {
+		return canonicalLink(raw, stripAffiliate)
+	}
+
+	handle := strings.TrimPrefix(raw, "@")
+	if !isAlphaNumeric(strings.Replace(handle, ".", "_", -1)) {
+		return "", errBadHandle
+	}
+	return socialProfileBases[n] + handle, nil
+}
+
+// canonicalisePost fills in the canonical link for every item
+// Call validatePost() first.
+func (c *Core) canonicalisePost(p *Post) {
+	for i := range p.ItemList {
+		p.ItemList[i].CanonicalLink, _ = canonicalLink(p.ItemList[i].Link, c.stripAffiliateTags)
+	}
+}
+
+// canonicaliseUser fills in the canonical social links
+// Call validateProfile() first.
+func (c *Core) canonicaliseUser(u *User) {
+	u.Social1URL, _ = canonicalSocial(0, u.Social1, c.stripAffiliateTags)
+	u.Social2URL, _ = canonicalSocial(1, u.Social2, c.stripAffiliateTags)
+	u.Social3URL, _ = canonicalSocial(2, u.Social3, c.stripAffiliateTags)
+}
@@ -0,0 +1,49 @@
+package showcash
+
+import "testing"
+
+func Test_canonicalLink(t *testing.T) {
+	tests := []struct {
+		name  string
+		raw   string
+		strip bool
+		want  string
+		err   error
+	}{
+		{name: "Empty", raw: "", want: ""},
+		{name: "No scheme", raw: "Example.com/desk", want: "https://example.com/desk"},
+		{name: "Default port and fragment", raw: "HTTP://example.com:80/a#b", want: "http://example.com/a"},
+		{name: "User info dropped", raw: "https://google.com@example.com/", want: "https://example.com/"},
+		{name: "Affiliate kept", raw: "https://amazon.com/dp/1?tag=abc-20&th=1", want: "https://amazon.com/dp/1?tag=abc-20&th=1"},
+		{name: "Affiliate stripped", raw: "https://amazon.com/dp/1?tag=abc-20&utm_source=x&th=1", strip: true, want: "https://amazon.com/dp/1?th=1"},
+		{name: "Javascript", raw: "javascript:alert(1)", err: errBadLink},
+		{name: "Data", raw: "data:text/html;base64,PHNjcmlwdD4=", err: errBadLink},
+		{name: "FTP", raw: "ftp://example.com/", err: errBadLink},
+		{name: "No host", raw: "https:///path", err: errBadLink},
+		{name: "Porn domain", raw: "https://pinkspornlist.com/", err: errBlockedLink},
+		{name: "Porn subdomain", raw: "www.zzhdporn.com/videos", err: errBlockedLink},
+		{name: "Lookalike parent", raw: "https://notzzhdporn.com/", want: "https://notzzhdporn.com/"},
+		{name: "IPv6", raw: "https://[2001:DB8::1]/shop", want: "https://[2001:db8::1]/shop"},
+		{name: "IPv6 with port", raw: "http://[2001:db8::1]:8080/", want: "http://[2001:db8::1]:8080/"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := canonicalLink(tt.raw, tt.strip)
+			if err != tt.err {
+				t.Fatalf("canonicalLink(%q) error = %v, want %v", tt.raw, err, tt.err)
+			}
+			if got != tt.want {
+				t.Errorf("canonicalLink(%q) = %q, want %q", tt.raw, got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_canonicalSocial(t *testing.T) {
+	if got, err := canonicalSocial(2, "@jack", false); err != nil || got != "https://twitter.com/jack" {
+		t.Errorf("canonicalSocial() = %q, %v", got, err)
+	}
+	if _, err := canonicalSocial(0, "javascript:alert(1)", false); err != errBadLink {
+		t.Errorf("canonicalSocial() error = %v, want %v", err, errBadLink)
+	}
+}
@@ -0,0 +1,237 @@
+package showcash
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+// Outcomes recorded against each LoginAttempt
+const (
+	loginOK        = "ok"
+	loginBadCreds  = "bad_creds"
+	loginThrottled = "throttled"
+	loginTwoFactor = "2fa_pending" // password was right, waiting on a code
+)
+
+const (
+	// loginFreeAttempts is how many typos anyone gets before slowing down
+	loginFreeAttempts = 3
+	loginBaseDelay    = time.Second
+	// loginIPFactor gives IPs more leeway than a single login as offices
+	// and phone networks put lots of people behind one address
+	loginIPFactor = 5
+	// Failures older than these are forgotten
+	loginWindow   = 24 * time.Hour
+	loginIPWindow = time.Hour
+	// The audit trail is kept this long, checked every loginPruneInterval
+	loginRetention     = 30 * 24 * time.Hour
+	loginPruneInterval = time.Hour
+)
+
+// loginPolicy decides how long someone waits after failing to log in
+type loginPolicy struct {
+	freeAttempts int
+	maxFailures  int // locked out for lockout after this many, zero disables it
+	lockout      time.Duration
+}
+
+func newLoginPolicy(maxFailures int, lockout time.Duration) loginPolicy {
+	return loginPolicy{
+		freeAttempts: loginFreeAttempts,
+		maxFailures:  maxFailures,
+		lockout:      lockout,
+	}
+}
+
+// forIP is the same policy scaled up for a whole IP address
+func (p loginPolicy) forIP() loginPolicy {
+	p.freeAttempts *= loginIPFactor
+	p.maxFailures *= loginIPFactor
+	return p
+}
+
+// retryAfter is how long until another attempt is allowed after failures
+// failed attempts, the last of which was at last. The wait doubles with
+// each failure past the free ones, up to the lockout.
+func (p loginPolicy) retryAfter(failures int, last, now time.Time) time.Duration {
+	var wait time.Duration
+	switch {
+	case p.maxFailures > 0 && failures >= p.maxFailures:
+		wait = p.lockout
+	case failures >= p.freeAttempts:
+		wait = p.lockout
+		if shift := uint(failures - p.freeAttempts); shift < 32 {
+			if backoff := loginBaseDelay << shift; backoff < wait {
+				wait = backoff
+			}
+		}
+	default:
+		return 0
+	}
+	if left := last.Add(wait).Sub(now); left > 0 {
+		return left
+	}
+	return 0
+}
+
+// trustedProxies are the load balancers allowed to tell us who the client
+// is with X-Forwarded-For
+type trustedProxies []*net.IPNet
+
+// parseTrustedProxies reads addresses like 10.0.0.0/8 or 10.1.2.3,
+// skipping any that don't parse
+func parseTrustedProxies(addrs []string) trustedProxies {
+	var tp trustedProxies
+	for _, addr := range addrs {
+		addr = strings.TrimSpace(addr)
+		if addr == "" {
+			continue
+		}
+		if !strings.Contains(addr, "/") {
+			if strings.Contains(addr, ":") {
+				addr += "/128"
+			} else {
+				addr += "/32"
+			}
+		}
+		_, n, err := net.ParseCIDR(addr)
+		if err != nil {
+			log.Println("Ignoring trusted proxy", addr, err)
+			continue
+		}
+		tp = append(tp, n)
+	}
+	return tp
+}
+
+func (tp trustedProxies) contains(ip net.IP) bool {
+	for _, n := range tp {
+		if ip != nil && n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP is the address the request came from, without the port. From
+// a trusted proxy it's the nearest address in X-Forwarded-For that the
+// proxies didn't add themselves, anyone else could have made those up.
+func (c *Core) clientIP(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+	if !c.trustedProxies.contains(net.ParseIP(host)) {
+		return host
+	}
+	hops := strings.Split(strings.Join(req.Header["X-Forwarded-For"], ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := net.ParseIP(strings.TrimSpace(hops[i]))
+		if ip == nil {
+			break
+		}
+		host = ip.String()
+		if !c.trustedProxies.contains(ip) {
+			break
+		}
+	}
+	return host
+}
+
+// loginAccount is the throttle key for a login, the account it belongs to
+// if there is one so every way of spelling it shares a counter, otherwise
+// what was typed
+func (c *Core) loginAccount(login string) (string, uuid.UUID) {
+	userID, err := c.dao.getUserIDByLogin(login)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Println("loginAccount().getUserIDByLogin failed", err)
+		}
+		return "login:" + strings.ToLower(login), uuid.Nil
+	}
+	return userLoginKey(userID), userID
+}
+
+// userLoginKey is the throttle key for an account
+func userLoginKey(userID uuid.UUID) string {
+	return "user:" + userID.String()
+}
+
+// loginThrottle counts an attempt against the account and the IP it comes
+// from before it's checked, and returns how long the caller has to wait.
+// A throttled attempt is handed straight back. Otherwise it stays counted
+// as a failure unless the caller calls loginPassed or refundLogin.
+func (c *Core) loginThrottle(account, ip string) time.Duration {
+	now := time.Now()
+	wait := c.takeLoginAttempt(account, c.loginPolicy, now.Add(-loginWindow), now)
+	if ipWait := c.takeLoginAttempt("ip:"+ip, c.loginPolicy.forIP(), now.Add(-loginIPWindow), now); ipWait > wait {
+		wait = ipWait
+	}
+	if wait > 0 {
+		c.refundLogin(account, ip)
+	}
+	return wait
+}
+
+func (c *Core) takeLoginAttempt(key string, policy loginPolicy, since, now time.Time) time.Duration {
+	failures, last, err := c.dao.takeLoginAttempt(key, since)
+	if err != nil {
+		log.Println("takeLoginAttempt() failed", err)
+		return 0
+	}
+	return policy.retryAfter(failures, last, now)
+}
+
+// refundLogin hands back an attempt that didn't fail
+func (c *Core) refundLogin(account, ip string) {
+	c.dao.refundLoginAttempt(account)
+	c.dao.refundLoginAttempt("ip:" + ip)
+}
+
+// loginPassed forgets the account's failures. The IP only gets its attempt
+// back, otherwise one good account would launder a credential stuffing run.
+func (c *Core) loginPassed(account, ip string) {
+	c.dao.clearLoginFailures(account)
+	c.dao.refundLoginAttempt("ip:" + ip)
+}
+
+// pruneLoginAttempts keeps the audit trail long enough to work out what
+// happened, and no longer
+func (c *Core) pruneLoginAttempts() {
+	for range time.Tick(loginPruneInterval) {
+		now := time.Now()
+		if err := c.dao.pruneLoginAttempts(now.Add(-loginRetention), now.Add(-loginWindow)); err != nil {
+			log.Println("pruneLoginAttempts() failed", err)
+		}
+	}
+}
+
+// recordLogin adds an attempt to the audit trail
+func (c *Core) recordLogin(req *http.Request, login string, userID uuid.UUID, outcome string) {
+	a := LoginAttempt{
+		Login:     login,
+		IP:        c.clientIP(req),
+		UserAgent: req.UserAgent(),
+		Outcome:   outcome,
+		CreatedAt: time.Now(),
+	}
+	if userID != uuid.Nil {
+		a.UserID = &userID
+	}
+	c.dao.recordLoginAttempt(a)
+}
+
+// throttledResponse tells the client when it can try again
+func throttledResponse(wr http.ResponseWriter, wait time.Duration) {
+	secs := int((wait + time.Second - 1) / time.Second)
+	wr.Header().Set("Retry-After", strconv.Itoa(secs))
+	apiTooManyRequestsError.withMessage("Too many attempts, try again later").write(wr)
+}
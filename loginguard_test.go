@@ -0,0 +1,125 @@
+package showcash
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func Test_loginPolicy_retryAfter(t *testing.T) {
+	p := newLoginPolicy(10, 15*time.Minute)
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		policy   loginPolicy
+		failures int
+		ago      time.Duration
+		want     time.Duration
+	}{
+		{"no failures", p, 0, 0, 0},
+		{"free attempts", p, 2, 0, 0},
+		{"first backoff", p, 3, 0, time.Second},
+		{"doubles", p, 5, 0, 4 * time.Second},
+		{"already waited", p, 5, 10 * time.Second, 0},
+		{"partly waited", p, 6, 3 * time.Second, 5 * time.Second},
+		{"locked out", p, 10, time.Minute, 14 * time.Minute},
+		{"lockout over", p, 12, 20 * time.Minute, 0},
+		{"backoff capped at lockout", newLoginPolicy(0, time.Minute), 60, 0, time.Minute},
+		{"ip gets more leeway", p.forIP(), 10, 0, 0},
+		{"ip locked out", p.forIP(), 50, 0, 15 * time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.retryAfter(tt.failures, now.Add(-tt.ago), now); got != tt.want {
+				t.Errorf("retryAfter() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCore_clientIP(t *testing.T) {
+	behindALB := New(NewMemStore(), WithTrustedProxies("10.0.0.0/8", "192.168.1.1", "nonsense"))
+	direct := New(NewMemStore())
+	tests := []struct {
+		name       string
+		c          *Core
+		remoteAddr string
+		forwarded  []string
+		want       string
+	}{
+		{"no proxies configured", direct, "10.0.0.5:4000", []string{"203.0.113.7"}, "10.0.0.5"},
+		{"untrusted proxy", behindALB, "198.51.100.2:4000", []string{"203.0.113.7"}, "198.51.100.2"},
+		{"trusted proxy", behindALB, "10.0.0.5:4000", []string{"203.0.113.7"}, "203.0.113.7"},
+		{"single trusted address", behindALB, "192.168.1.1:4000", []string{"203.0.113.7"}, "203.0.113.7"},
+		{"trusted proxy without the header", behindALB, "10.0.0.5:4000", nil, "10.0.0.5"},
+		{"spoofed hops are skipped", behindALB, "10.0.0.5:4000", []string{"1.2.3.4, 203.0.113.7"}, "203.0.113.7"},
+		{"chain of proxies", behindALB, "10.0.0.5:4000", []string{"203.0.113.7, 10.0.0.9"}, "203.0.113.7"},
+		{"repeated headers", behindALB, "10.0.0.5:4000", []string{"1.2.3.4", "203.0.113.7"}, "203.0.113.7"},
+		{"garbage stops the walk", behindALB, "10.0.0.5:4000", []string{"203.0.113.7, nope, 10.0.0.9"}, "10.0.0.9"},
+		{"ipv6", behindALB, "10.0.0.5:4000", []string{"2001:db8::1"}, "2001:db8::1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/auth/login", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for _, f := range tt.forwarded {
+				req.Header.Add("X-Forwarded-For", f)
+			}
+			if got := tt.c.clientIP(req); got != tt.want {
+				t.Errorf("clientIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCore_HandlerLoginThrottle(t *testing.T) {
+	store := NewMemStore()
+	srv := httptest.NewServer(New(store).Handler())
+	defer srv.Close()
+	newTestUser(t, store, "Nick")
+
+	// Guesses sent all at once, however they spell the account, still only
+	// get the free attempts
+	spellings := []string{"Nick", "nick", "NICK@example.com"}
+	codes := make(chan int, 3*len(spellings))
+	var wg sync.WaitGroup
+	for i := 0; i < cap(codes); i++ {
+		wg.Add(1)
+		go func(login string) {
+			defer wg.Done()
+			codes <- newAPIClient(t, srv).do(http.MethodPost, "/auth/login", map[string]string{"username": login, "password": "wrong"}, nil)
+		}(spellings[i%len(spellings)])
+	}
+	wg.Wait()
+	close(codes)
+	tried := 0
+	for code := range codes {
+		switch code {
+		case http.StatusUnauthorized:
+			tried++
+		case http.StatusTooManyRequests:
+		default:
+			t.Errorf("parallel login = %d", code)
+		}
+	}
+	if tried != loginFreeAttempts {
+		t.Errorf("%d parallel guesses were checked, want %d", tried, loginFreeAttempts)
+	}
+
+	// A good login clears the account but the IP only gets its attempt back
+	c := New(store)
+	for i := 0; i < loginFreeAttempts; i++ {
+		if wait := c.loginThrottle("login:kim", "203.0.113.7"); wait != 0 {
+			t.Fatalf("free attempt %d waited %v", i, wait)
+		}
+	}
+	c.loginPassed("login:kim", "203.0.113.7")
+	if wait := c.loginThrottle("login:kim", "203.0.113.7"); wait != 0 {
+		t.Errorf("attempt after a good login waited %v", wait)
+	}
+	if got := store.loginThrottle["ip:203.0.113.7"].failures; got != loginFreeAttempts {
+		t.Errorf("ip failures after a good login = %d, want %d", got, loginFreeAttempts)
+	}
+}
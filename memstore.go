@@ -0,0 +1,1657 @@
+package showcash
+
+import (
+	"bytes"
+	"database/sql"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+// MemStore keeps everything in memory, it's what the handler tests run
+// against and it's handy for working on the frontend without postgres.
+// It follows the same rules as the DAO, so a missing row is still
+// sql.ErrNoRows and a clash is still errNotUnique, but nothing survives a
+// restart.
+type MemStore struct {
+	mu            sync.Mutex
+	users         []*memUser
+	posts         []*memPost
+	comments      []*memComment
+	follows       []memFollow // oldest first
+	tags          map[string]bool
+	tagFollows    map[uuid.UUID]map[string]bool
+	reports       []Report
+	filterRules   []FilterRule
+	oldUsernames  map[string]memReservation
+	userTokens    map[string]*memUserToken
+	jobs          []*AccountJob
+	loginAttempts []LoginAttempt
+	loginThrottle map[string]*memThrottle
+	recoveryCodes map[uuid.UUID]map[string]bool // code hash to whether it's used
+	oauth         map[[2]string]uuid.UUID       // provider and subject
+	apiTokens     []*memAPIToken
+}
+
+type memUser struct {
+	User
+	hidden            bool
+	moderator         bool
+	usernameChangedAt time.Time
+	totpSecret        string
+	totpLastStep      int64
+}
+
+type memPost struct {
+	Post
+	userID uuid.UUID
+	hidden bool
+	views  map[string]bool
+	tags   map[string]bool
+}
+
+type memComment struct {
+	Comment
+	hidden bool
+}
+
+type memFollow struct {
+	follower uuid.UUID
+	followee uuid.UUID
+}
+
+type memReservation struct {
+	userID uuid.UUID
+	until  time.Time
+}
+
+type memThrottle struct {
+	failures int
+	last     time.Time
+	previous time.Time
+}
+
+type memUserToken struct {
+	UserToken
+	used bool
+}
+
+type memAPIToken struct {
+	APIToken
+	hash    string
+	revoked bool
+}
+
+// NewMemStore is an empty in memory Store
+func NewMemStore() *MemStore {
+	return &MemStore{
+		tags:          map[string]bool{},
+		tagFollows:    map[uuid.UUID]map[string]bool{},
+		oldUsernames:  map[string]memReservation{},
+		userTokens:    map[string]*memUserToken{},
+		recoveryCodes: map[uuid.UUID]map[string]bool{},
+		oauth:         map[[2]string]uuid.UUID{},
+		loginThrottle: map[string]*memThrottle{},
+	}
+}
+
+// IsConnected is always true, there's nothing to lose touch with
+func (m *MemStore) IsConnected() bool {
+	return m != nil
+}
+
+// Close does nothing
+func (m *MemStore) Close() error {
+	return nil
+}
+
+// The helpers below expect m.mu to be held already
+
+func (m *MemStore) user(userID uuid.UUID) *memUser {
+	for _, u := range m.users {
+		if u.UserID == userID {
+			return u
+		}
+	}
+	return nil
+}
+
+func (m *MemStore) userByHandle(handle string) *memUser {
+	for _, u := range m.users {
+		if u.Username == handle && !u.hidden {
+			return u
+		}
+	}
+	return nil
+}
+
+func (m *MemStore) post(postID uuid.UUID) *memPost {
+	for _, p := range m.posts {
+		if p.ID == postID {
+			return p
+		}
+	}
+	return nil
+}
+
+// postRow is a post as the listings return it, without items or tags.
+// Posts whose user has gone don't show up, same as the join.
+func (m *MemStore) postRow(p *memPost) (Post, bool) {
+	u := m.user(p.userID)
+	if u == nil {
+		return Post{}, false
+	}
+	return Post{
+		ID:       p.ID,
+		Username: u.Username,
+		Title:    p.Title,
+		ImageURI: p.ImageURI,
+		Date:     p.Date,
+	}, true
+}
+
+// latestPosts is the newest visible posts matching keep
+func (m *MemStore) latestPosts(keep func(p *memPost) bool, limit int) []Post {
+	var posts []Post
+	for i := len(m.posts) - 1; i >= 0 && len(posts) < limit; i-- {
+		p := m.posts[i]
+		if p.hidden || !keep(p) {
+			continue
+		}
+		if row, ok := m.postRow(p); ok {
+			posts = append(posts, row)
+		}
+	}
+	return posts
+}
+
+func sortedItems(items []Item) []Item {
+	if len(items) == 0 {
+		return nil
+	}
+	sorted := append([]Item(nil), items...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].ID < sorted[j].ID })
+	return sorted
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := []string{}
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (m *MemStore) createPost(userID uuid.UUID, p Post) (Post, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	p.ID = uuid.Must(uuid.NewV4())
+	p.Date = time.Now()
+	m.posts = append(m.posts, &memPost{
+		Post: Post{
+			ID:       p.ID,
+			Title:    p.Title,
+			ImageURI: p.ImageURI,
+			Date:     p.Date,
+		},
+		userID: userID,
+		views:  map[string]bool{},
+		tags:   map[string]bool{},
+	})
+	return p, nil
+}
+
+func (m *MemStore) claimPost(userID uuid.UUID, postID uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, p := range m.posts {
+		if postID == uuid.Nil || p.ID == postID {
+			p.userID = userID
+		}
+	}
+	return nil
+}
+
+func (m *MemStore) updatePost(userID uuid.UUID, p Post) (Post, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	mp := m.post(p.ID)
+	if mp == nil || mp.userID != userID {
+		return Post{}, sql.ErrNoRows
+	}
+	mp.Title = p.Title
+	mp.ImageURI = p.ImageURI
+	for _, item := range p.ItemList {
+		found := false
+		for i := range mp.ItemList {
+			if mp.ItemList[i].ID == item.ID {
+				mp.ItemList[i] = item
+				found = true
+			}
+		}
+		if !found {
+			mp.ItemList = append(mp.ItemList, item)
+		}
+	}
+	return p, nil
+}
+
+func (m *MemStore) getPost(postID uuid.UUID) (Post, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	mp := m.post(postID)
+	if mp == nil || mp.hidden {
+		return Post{}, sql.ErrNoRows
+	}
+	p, ok := m.postRow(mp)
+	if !ok {
+		return Post{}, sql.ErrNoRows
+	}
+	p.ItemList = sortedItems(mp.ItemList)
+	return p, nil
+}
+
+func (m *MemStore) deletePost(postID uuid.UUID) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	posts := m.posts[:0]
+	for _, p := range m.posts {
+		if p.ID != postID {
+			posts = append(posts, p)
+		}
+	}
+	m.posts = posts
+}
+
+func (m *MemStore) increaseView(postID uuid.UUID, uniqueValue string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if p := m.post(postID); p != nil {
+		p.views[uniqueValue] = true
+	}
+}
+
+func (m *MemStore) getLatestPosts() []Post {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.latestPosts(func(*memPost) bool { return true }, 8)
+}
+
+func (m *MemStore) getUsersLatestPosts(userID uuid.UUID) []Post {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.latestPosts(func(p *memPost) bool { return p.userID == userID }, 50)
+}
+
+// getMostViewedPosts uses the same rating as the DAO
+func (m *MemStore) getMostViewedPosts() []Post {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	type rated struct {
+		post   Post
+		rating float64
+	}
+	var all []rated
+	for _, p := range m.posts {
+		if p.hidden || len(p.views) == 0 {
+			continue
+		}
+		if row, ok := m.postRow(p); ok {
+			rating := math.Log10(float64(len(p.views)+1))*287015 + float64(p.Date.Unix())
+			all = append(all, rated{row, rating})
+		}
+	}
+	sort.SliceStable(all, func(i, j int) bool { return all[i].rating > all[j].rating })
+
+	var posts []Post
+	for i := 0; i < len(all) && i < 8; i++ {
+		posts = append(posts, all[i].post)
+	}
+	return posts
+}
+
+func (m *MemStore) getCommentsForPostID(postID uuid.UUID) []Comment {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var comments []Comment
+	for _, c := range m.comments {
+		if c.PostID == postID && !c.hidden {
+			comment := c.Comment
+			comment.PostID = uuid.Nil
+			comments = append(comments, comment)
+		}
+	}
+	return comments
+}
+
+func (m *MemStore) createComment(userID uuid.UUID, postID uuid.UUID, c Comment) (Comment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	c.ID = uuid.Must(uuid.NewV4())
+	c.Date = time.Now()
+	m.comments = append(m.comments, &memComment{Comment: Comment{
+		ID:       c.ID,
+		Date:     c.Date,
+		Comment:  c.Comment,
+		Username: c.Username,
+		UserID:   userID,
+		PostID:   postID,
+	}})
+	return c, nil
+}
+
+func profileOf(u *memUser) UserProfile {
+	return UserProfile{
+		UserID:      u.UserID,
+		Username:    u.Username,
+		RealName:    u.RealName,
+		Location:    u.Location,
+		ProfileURI:  u.ProfileURI,
+		Bio:         u.Bio,
+		Social1:     u.Social1,
+		Social2:     u.Social2,
+		Social3:     u.Social3,
+		Social1URL:  u.Social1URL,
+		Social2URL:  u.Social2URL,
+		Social3URL:  u.Social3URL,
+		MemberSince: u.CreatedAt,
+	}
+}
+
+func (m *MemStore) profileByID(userID uuid.UUID) (UserProfile, error) {
+	up := UserProfile{}
+	err := sql.ErrNoRows
+	if u := m.user(userID); u != nil {
+		up, err = profileOf(u), nil
+	}
+	up.UserID = userID
+	up.Interests = m.interests(userID)
+	m.hydrate(&up)
+	return up, err
+}
+
+func (m *MemStore) getUserProfileByID(userID uuid.UUID) (UserProfile, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.profileByID(userID)
+}
+
+func (m *MemStore) getUserProfileByHandle(handle string) (UserProfile, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	up := UserProfile{}
+	err := sql.ErrNoRows
+	if u := m.userByHandle(handle); u != nil {
+		up, err = profileOf(u), nil
+	}
+	up.Interests = m.interests(up.UserID)
+	m.hydrate(&up)
+	return up, err
+}
+
+func (m *MemStore) getUserIDByHandle(handle string) (uuid.UUID, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if u := m.userByHandle(handle); u != nil {
+		return u.UserID, nil
+	}
+	return uuid.Nil, sql.ErrNoRows
+}
+
+// loginUser is the columns a login hands back
+func loginUser(u *memUser) User {
+	lu := u.User
+	lu.SessionEpoch = 0
+	lu.CreatedAt = time.Time{}
+	lu.Interests = nil
+	return lu
+}
+
+func (m *MemStore) getUserByUsernameAndPassword(username, password string) (User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var found *memUser
+	for _, u := range m.users {
+		if strings.ToLower(u.Username) != strings.ToLower(username) || u.Password != password {
+			continue
+		}
+		if found == nil || u.Username == username {
+			found = u
+		}
+	}
+	if found == nil {
+		return User{}, sql.ErrNoRows
+	}
+	return loginUser(found), nil
+}
+
+func (m *MemStore) getLoginUser(userID uuid.UUID) (User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if u := m.user(userID); u != nil {
+		return loginUser(u), nil
+	}
+	return User{}, sql.ErrNoRows
+}
+
+func (m *MemStore) getUserByEmailAndPassword(email, password string) (User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, u := range m.users {
+		if strings.ToLower(u.EmailAddress) == strings.ToLower(email) && u.Password == password {
+			return loginUser(u), nil
+		}
+	}
+	return User{}, sql.ErrNoRows
+}
+
+func (m *MemStore) createUser(u User) (User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.addUser(u)
+}
+
+// addUser expects m.mu to be held
+func (m *MemStore) addUser(u User) (User, error) {
+	u.UserID = uuid.Must(uuid.NewV4())
+	for _, other := range m.users {
+		if strings.EqualFold(other.Username, u.Username) || strings.EqualFold(other.EmailAddress, u.EmailAddress) {
+			return u, errNotUnique
+		}
+	}
+
+	stored := u
+	stored.ShadowBanned = false
+	stored.EmailVerified = false
+	stored.TOTPEnabled = false
+	stored.SessionEpoch = 0
+	stored.Interests = nil
+	stored.CreatedAt = time.Now()
+	m.users = append(m.users, &memUser{User: stored})
+	return u, nil
+}
+
+func (m *MemStore) updateUser(u User) (User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if stored := m.user(u.UserID); stored != nil {
+		stored.RealName = u.RealName
+		stored.Location = u.Location
+		stored.Bio = u.Bio
+		stored.Social1 = u.Social1
+		stored.Social2 = u.Social2
+		stored.Social3 = u.Social3
+		stored.Social1URL = u.Social1URL
+		stored.Social2URL = u.Social2URL
+		stored.Social3URL = u.Social3URL
+	}
+	return u, nil
+}
+
+func (m *MemStore) setProfileURI(userID uuid.UUID, uri string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u := m.user(userID)
+	if u == nil {
+		return "", sql.ErrNoRows
+	}
+	previous := u.ProfileURI
+	u.ProfileURI = uri
+	return previous, nil
+}
+
+func (m *MemStore) changeUsername(userID uuid.UUID, username string, cooldown, reservation time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u := m.user(userID)
+	if u == nil {
+		return sql.ErrNoRows
+	}
+	current := u.Username
+	if current == username {
+		return nil
+	}
+	if !u.usernameChangedAt.IsZero() && time.Since(u.usernameChangedAt) < cooldown {
+		return errUsernameCooldown
+	}
+
+	now := time.Now()
+	for old, r := range m.oldUsernames {
+		if strings.ToLower(old) == strings.ToLower(username) && r.userID != userID && r.until.After(now) {
+			return errUsernameTaken
+		}
+	}
+	for _, other := range m.users {
+		if strings.EqualFold(other.Username, username) && other.UserID != userID {
+			return errUsernameTaken
+		}
+	}
+
+	u.Username = username
+	u.usernameChangedAt = now
+	m.oldUsernames[current] = memReservation{userID: userID, until: now.Add(reservation)}
+	if r, ok := m.oldUsernames[username]; ok && r.userID == userID {
+		delete(m.oldUsernames, username)
+	}
+	for _, c := range m.comments {
+		if c.UserID == userID {
+			c.Username = username
+		}
+	}
+	return nil
+}
+
+func (m *MemStore) getCurrentUsername(oldHandle string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	for old, r := range m.oldUsernames {
+		if !strings.EqualFold(old, oldHandle) || !r.until.After(now) {
+			continue
+		}
+		if u := m.user(r.userID); u != nil && !u.hidden {
+			return u.Username, nil
+		}
+	}
+	return "", sql.ErrNoRows
+}
+
+func (m *MemStore) isUsernameReserved(username string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	for old, r := range m.oldUsernames {
+		if strings.ToLower(old) == strings.ToLower(username) && r.until.After(now) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *MemStore) addTags(tags []string) []string {
+	tags = cleanTags(tags)
+	for _, t := range tags {
+		m.tags[t] = true
+	}
+	return tags
+}
+
+func (m *MemStore) createTags(tags []string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.addTags(tags), nil
+}
+
+func (m *MemStore) setPostTags(postID uuid.UUID, tags []string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	tags = m.addTags(tags)
+	if p := m.post(postID); p != nil {
+		for _, t := range tags {
+			p.tags[t] = true
+		}
+	}
+}
+
+func (m *MemStore) removePostTags(postID uuid.UUID, tags []string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if p := m.post(postID); p != nil {
+		for _, t := range tags {
+			delete(p.tags, t)
+		}
+	}
+}
+
+func (m *MemStore) getMostPopularTags() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	counts := map[string]int{}
+	for _, p := range m.posts {
+		for t := range p.tags {
+			counts[t]++
+		}
+	}
+	var tags []string
+	for t := range counts {
+		tags = append(tags, t)
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		if counts[tags[i]] != counts[tags[j]] {
+			return counts[tags[i]] > counts[tags[j]]
+		}
+		return tags[i] < tags[j]
+	})
+	if len(tags) > 12 {
+		tags = tags[:12]
+	}
+	return tags
+}
+
+func (m *MemStore) getPostsByTags(tags []string) []Post {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var posts []Post
+	for _, p := range m.posts {
+		if p.hidden {
+			continue
+		}
+		for _, t := range tags {
+			if p.tags[t] {
+				if row, ok := m.postRow(p); ok {
+					posts = append(posts, row)
+				}
+				break
+			}
+		}
+	}
+	sort.Slice(posts, func(i, j int) bool { return bytes.Compare(posts[i].ID[:], posts[j].ID[:]) < 0 })
+	if len(posts) > 50 {
+		posts = posts[:50]
+	}
+	return posts
+}
+
+func (m *MemStore) createReport(r Report) (Report, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	r.ID = uuid.Must(uuid.NewV4())
+	r.CreatedAt = time.Now()
+	for _, other := range m.reports {
+		if other.ReporterID == r.ReporterID && other.TargetType == r.TargetType && other.TargetID == r.TargetID {
+			return r, errNotUnique
+		}
+	}
+	m.reports = append(m.reports, r)
+	return r, nil
+}
+
+// reportTarget is the hidden flag of whatever was reported, nil if it
+// isn't there
+func (m *MemStore) reportTarget(targetType string, targetID uuid.UUID) *bool {
+	switch targetType {
+	case "post":
+		if p := m.post(targetID); p != nil {
+			return &p.hidden
+		}
+	case "comment":
+		for _, c := range m.comments {
+			if c.ID == targetID {
+				return &c.hidden
+			}
+		}
+	case "user":
+		if u := m.user(targetID); u != nil {
+			return &u.hidden
+		}
+	}
+	return nil
+}
+
+func (m *MemStore) reportTargetExists(targetType string, targetID uuid.UUID) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.reportTarget(targetType, targetID) != nil
+}
+
+func (m *MemStore) hideIfReported(targetType string, targetID uuid.UUID, threshold int) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	hidden := m.reportTarget(targetType, targetID)
+	if hidden == nil || *hidden || threshold <= 0 {
+		return false, nil
+	}
+	reports := 0
+	for _, r := range m.reports {
+		if r.TargetType == targetType && r.TargetID == targetID {
+			reports++
+		}
+	}
+	if reports < threshold {
+		return false, nil
+	}
+	*hidden = true
+	return true, nil
+}
+
+func (m *MemStore) getReportSummaries() []ReportSummary {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var summaries []ReportSummary
+	index := map[[2]string]int{}
+	for _, r := range m.reports {
+		key := [2]string{r.TargetType, r.TargetID.String()}
+		i, ok := index[key]
+		if !ok {
+			i = len(summaries)
+			index[key] = i
+			summaries = append(summaries, ReportSummary{TargetType: r.TargetType, TargetID: r.TargetID})
+			if hidden := m.reportTarget(r.TargetType, r.TargetID); hidden != nil {
+				summaries[i].Hidden = *hidden
+			}
+		}
+		s := &summaries[i]
+		s.Reports++
+		s.Reasons = append(s.Reasons, r.Reason)
+		if r.CreatedAt.After(s.LastReported) {
+			s.LastReported = r.CreatedAt
+		}
+	}
+	sort.SliceStable(summaries, func(i, j int) bool {
+		if summaries[i].Reports != summaries[j].Reports {
+			return summaries[i].Reports > summaries[j].Reports
+		}
+		return summaries[i].LastReported.After(summaries[j].LastReported)
+	})
+	if len(summaries) > 100 {
+		summaries = summaries[:100]
+	}
+	return summaries
+}
+
+func (m *MemStore) isModerator(userID uuid.UUID) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u := m.user(userID)
+	return u != nil && u.moderator
+}
+
+func (m *MemStore) getFilterRules() ([]FilterRule, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]FilterRule(nil), m.filterRules...), nil
+}
+
+func (m *MemStore) hydrate(up *UserProfile) {
+	up.Friends = []UserProfile{}
+	up.Followers = []UserProfile{}
+	if up.UserID == uuid.Nil {
+		return
+	}
+	up.Friends = m.followPage(up.UserID, false, profileFollowPreview, 0)
+	up.Followers = m.followPage(up.UserID, true, profileFollowPreview, 0)
+	for _, f := range m.follows {
+		if f.followee == up.UserID && m.followListed(f.follower) {
+			up.FollowerCount++
+		}
+		if f.follower == up.UserID && m.followListed(f.followee) {
+			up.FollowingCount++
+		}
+	}
+}
+
+// followListed is whether a user shows up in follow lists and counts
+func (m *MemStore) followListed(userID uuid.UUID) bool {
+	u := m.user(userID)
+	return u != nil && !u.hidden && !u.ShadowBanned
+}
+
+// followPage is a page of userID's followers, or who they follow, most
+// recent first
+func (m *MemStore) followPage(userID uuid.UUID, followers bool, limit, offset int) []UserProfile {
+	page := []UserProfile{}
+	for i := len(m.follows) - 1; i >= 0 && len(page) < limit; i-- {
+		f := m.follows[i]
+		otherID := f.followee
+		if followers {
+			otherID = f.follower
+		}
+		if (followers && f.followee != userID) || (!followers && f.follower != userID) {
+			continue
+		}
+		if !m.followListed(otherID) {
+			continue
+		}
+		other := m.user(otherID)
+		if offset > 0 {
+			offset--
+			continue
+		}
+		page = append(page, UserProfile{
+			UserID:     other.UserID,
+			Username:   other.Username,
+			RealName:   other.RealName,
+			ProfileURI: other.ProfileURI,
+		})
+	}
+	return page
+}
+
+func (m *MemStore) hydrateFollows(up *UserProfile) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.hydrate(up)
+}
+
+func (m *MemStore) follow(followerID, followeeID uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f := memFollow{follower: followerID, followee: followeeID}
+	for _, existing := range m.follows {
+		if existing == f {
+			return nil
+		}
+	}
+	m.follows = append(m.follows, f)
+	return nil
+}
+
+func (m *MemStore) unfollow(followerID, followeeID uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	follows := m.follows[:0]
+	for _, f := range m.follows {
+		if f.follower != followerID || f.followee != followeeID {
+			follows = append(follows, f)
+		}
+	}
+	m.follows = follows
+	return nil
+}
+
+func (m *MemStore) getFollowers(userID uuid.UUID, limit, offset int) []UserProfile {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.followPage(userID, true, limit, offset)
+}
+
+func (m *MemStore) getFollowing(userID uuid.UUID, limit, offset int) []UserProfile {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.followPage(userID, false, limit, offset)
+}
+
+func (m *MemStore) hasFollows(userID uuid.UUID) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, f := range m.follows {
+		if f.follower == userID {
+			return true
+		}
+	}
+	return len(m.tagFollows[userID]) > 0
+}
+
+func (m *MemStore) getFeed(userID uuid.UUID, cursor *feedCursor, limit int) []Post {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	followed := map[uuid.UUID]bool{}
+	for _, f := range m.follows {
+		if f.follower == userID {
+			followed[f.followee] = true
+		}
+	}
+	interests := m.tagFollows[userID]
+
+	var posts []Post
+	for _, p := range m.posts {
+		if p.hidden {
+			continue
+		}
+		wanted := followed[p.userID]
+		for t := range p.tags {
+			wanted = wanted || interests[t]
+		}
+		if !wanted {
+			continue
+		}
+		if cursor != nil && !(p.Date.Before(cursor.Date) ||
+			p.Date.Equal(cursor.Date) && bytes.Compare(p.ID[:], cursor.ID[:]) < 0) {
+			continue
+		}
+		if row, ok := m.postRow(p); ok {
+			posts = append(posts, row)
+		}
+	}
+	sort.Slice(posts, func(i, j int) bool {
+		if !posts[i].Date.Equal(posts[j].Date) {
+			return posts[i].Date.After(posts[j].Date)
+		}
+		return bytes.Compare(posts[i].ID[:], posts[j].ID[:]) > 0
+	})
+	if len(posts) > limit {
+		posts = posts[:limit]
+	}
+	return posts
+}
+
+func (m *MemStore) addTagFollows(userID uuid.UUID, tags []string) {
+	tags = m.addTags(tags)
+	if m.tagFollows[userID] == nil {
+		m.tagFollows[userID] = map[string]bool{}
+	}
+	for _, t := range tags {
+		m.tagFollows[userID][t] = true
+	}
+}
+
+func (m *MemStore) followTags(userID uuid.UUID, tags []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.addTagFollows(userID, tags)
+	return nil
+}
+
+func (m *MemStore) unfollowTags(userID uuid.UUID, tags []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, t := range tags {
+		delete(m.tagFollows[userID], t)
+	}
+	return nil
+}
+
+func (m *MemStore) interests(userID uuid.UUID) []string {
+	return sortedKeys(m.tagFollows[userID])
+}
+
+func (m *MemStore) getInterests(userID uuid.UUID) []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.interests(userID)
+}
+
+func (m *MemStore) setInterests(userID uuid.UUID, interests []string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	interests = cleanTags(interests)
+	keep := map[string]bool{}
+	for _, t := range interests {
+		keep[t] = true
+	}
+	for t := range m.tagFollows[userID] {
+		if !keep[t] {
+			delete(m.tagFollows[userID], t)
+		}
+	}
+	if len(interests) == 0 {
+		return interests, nil
+	}
+	m.addTagFollows(userID, interests)
+	return interests, nil
+}
+
+func (m *MemStore) createUserToken(t UserToken) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.userTokens[t.TokenHash]; ok {
+		return errNotUnique
+	}
+	m.userTokens[t.TokenHash] = &memUserToken{UserToken: t}
+	return nil
+}
+
+func (m *MemStore) consumeUserToken(tokenHash, purpose string) (UserToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t, ok := m.userTokens[tokenHash]
+	if !ok || t.Purpose != purpose || t.used || !t.ExpiresAt.After(time.Now()) {
+		return UserToken{}, sql.ErrNoRows
+	}
+	t.used = true
+	return t.UserToken, nil
+}
+
+func (m *MemStore) setEmailVerified(userID uuid.UUID, email string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u := m.user(userID)
+	if u == nil || u.EmailAddress != email {
+		return sql.ErrNoRows
+	}
+	u.EmailVerified = true
+	return nil
+}
+
+func (m *MemStore) isEmailVerified(userID uuid.UUID) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u := m.user(userID)
+	return u != nil && u.EmailVerified
+}
+
+func (m *MemStore) getEmailAddress(userID uuid.UUID) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if u := m.user(userID); u != nil {
+		return u.EmailAddress, nil
+	}
+	return "", sql.ErrNoRows
+}
+
+func (m *MemStore) getSessionEpoch(userID uuid.UUID) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if u := m.user(userID); u != nil {
+		return u.SessionEpoch, nil
+	}
+	return 0, sql.ErrNoRows
+}
+
+func (m *MemStore) getUserByEmail(email string) (User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, u := range m.users {
+		if strings.ToLower(u.EmailAddress) == strings.ToLower(email) {
+			return User{
+				UserID:       u.UserID,
+				Username:     u.Username,
+				EmailAddress: u.EmailAddress,
+			}, nil
+		}
+	}
+	return User{}, sql.ErrNoRows
+}
+
+func (m *MemStore) resetPassword(userID uuid.UUID, password string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.setPassword(userID, password)
+	return nil
+}
+
+func (m *MemStore) resetPasswordWithToken(tokenHash string, userID uuid.UUID, password string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t, ok := m.userTokens[tokenHash]
+	if !ok || t.UserID != userID || t.Purpose != tokenResetPassword || t.used || !t.ExpiresAt.After(time.Now()) {
+		return sql.ErrNoRows
+	}
+	m.setPassword(userID, password)
+	return nil
+}
+
+// setPassword is resetPassword for when the lock is held
+func (m *MemStore) setPassword(userID uuid.UUID, password string) {
+	if u := m.user(userID); u != nil {
+		u.Password = password
+		u.SessionEpoch++
+	}
+	for _, t := range m.userTokens {
+		if t.UserID == userID && t.Purpose == tokenResetPassword {
+			t.used = true
+		}
+	}
+	for _, t := range m.apiTokens {
+		if t.UserID == userID {
+			t.revoked = true
+		}
+	}
+}
+
+func (m *MemStore) checkPassword(userID uuid.UUID, password string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u := m.user(userID)
+	return u != nil && u.Password == password
+}
+
+func (m *MemStore) changeEmail(userID uuid.UUID, email string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, other := range m.users {
+		if strings.EqualFold(other.EmailAddress, email) && other.UserID != userID {
+			return errNotUnique
+		}
+	}
+	if u := m.user(userID); u != nil {
+		u.EmailAddress = email
+		u.EmailVerified = true
+	}
+	return nil
+}
+
+func (m *MemStore) getAccountExport(userID uuid.UUID) (AccountExport, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ex := AccountExport{ExportedAt: time.Now()}
+	u := m.user(userID)
+	if u == nil {
+		return ex, sql.ErrNoRows
+	}
+	ex.User = User{
+		UserID:        u.UserID,
+		Username:      u.Username,
+		RealName:      u.RealName,
+		Location:      u.Location,
+		ProfileURI:    u.ProfileURI,
+		Bio:           u.Bio,
+		Social1:       u.Social1,
+		Social2:       u.Social2,
+		Social3:       u.Social3,
+		Social1URL:    u.Social1URL,
+		Social2URL:    u.Social2URL,
+		Social3URL:    u.Social3URL,
+		EmailAddress:  u.EmailAddress,
+		EmailVerified: u.EmailVerified,
+		CreatedAt:     u.CreatedAt,
+		Interests:     m.interests(userID),
+	}
+
+	var err error
+	if ex.Profile, err = m.profileByID(userID); err != nil {
+		return ex, err
+	}
+
+	for _, p := range m.posts {
+		if p.userID != userID {
+			continue
+		}
+		post := Post{
+			ID:       p.ID,
+			Username: u.Username,
+			Title:    p.Title,
+			ImageURI: p.ImageURI,
+			Date:     p.Date,
+			ItemList: sortedItems(p.ItemList),
+		}
+		if len(p.tags) > 0 {
+			post.Tags = sortedKeys(p.tags)
+		}
+		ex.Posts = append(ex.Posts, post)
+	}
+	for _, c := range m.comments {
+		if c.UserID == userID {
+			ex.Comments = append(ex.Comments, c.Comment)
+		}
+	}
+	return ex, nil
+}
+
+func (m *MemStore) deleteAccount(userID uuid.UUID) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var images []string
+	gone := map[uuid.UUID]bool{}
+	posts := m.posts[:0]
+	for _, p := range m.posts {
+		if p.userID != userID {
+			posts = append(posts, p)
+			continue
+		}
+		gone[p.ID] = true
+		if p.ImageURI != "" {
+			images = append(images, p.ImageURI)
+		}
+	}
+	m.posts = posts
+	if u := m.user(userID); u != nil && u.ProfileURI != "" {
+		images = append(images, u.ProfileURI)
+	}
+
+	comments := m.comments[:0]
+	for _, c := range m.comments {
+		if gone[c.PostID] {
+			continue
+		}
+		if c.UserID == userID {
+			c.Comment.Comment = "[deleted]"
+			c.Username = "[deleted]"
+			c.UserID = uuid.Nil
+		}
+		comments = append(comments, c)
+	}
+	m.comments = comments
+
+	follows := m.follows[:0]
+	for _, f := range m.follows {
+		if f.follower != userID && f.followee != userID {
+			follows = append(follows, f)
+		}
+	}
+	m.follows = follows
+	delete(m.tagFollows, userID)
+
+	reports := m.reports[:0]
+	for _, r := range m.reports {
+		if r.ReporterID != userID {
+			reports = append(reports, r)
+		}
+	}
+	m.reports = reports
+
+	for hash, t := range m.userTokens {
+		if t.UserID == userID {
+			delete(m.userTokens, hash)
+		}
+	}
+	delete(m.recoveryCodes, userID)
+
+	logins := map[string]bool{}
+	if u := m.user(userID); u != nil {
+		logins[strings.ToLower(u.Username)] = true
+		logins[strings.ToLower(u.EmailAddress)] = true
+	}
+	for name, r := range m.oldUsernames {
+		if r.userID == userID {
+			logins[strings.ToLower(name)] = true
+		}
+	}
+	for key, id := range m.oauth {
+		if id == userID {
+			logins[oauthLogin(key[0], key[1])] = true
+		}
+	}
+	attempts := m.loginAttempts[:0]
+	for _, a := range m.loginAttempts {
+		if (a.UserID == nil || *a.UserID != userID) && !logins[a.Login] {
+			attempts = append(attempts, a)
+		}
+	}
+	m.loginAttempts = attempts
+	delete(m.loginThrottle, userLoginKey(userID))
+	for login := range logins {
+		delete(m.loginThrottle, "login:"+login)
+	}
+
+	for key, id := range m.oauth {
+		if id == userID {
+			delete(m.oauth, key)
+		}
+	}
+	tokens := m.apiTokens[:0]
+	for _, t := range m.apiTokens {
+		if t.UserID != userID {
+			tokens = append(tokens, t)
+		}
+	}
+	m.apiTokens = tokens
+	for name, r := range m.oldUsernames {
+		if r.userID == userID {
+			delete(m.oldUsernames, name)
+		}
+	}
+
+	users := m.users[:0]
+	for _, u := range m.users {
+		if u.UserID != userID {
+			users = append(users, u)
+		}
+	}
+	m.users = users
+	return images, nil
+}
+
+func (m *MemStore) createAccountJob(userID uuid.UUID, kind string) (AccountJob, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	j := AccountJob{
+		ID:        uuid.Must(uuid.NewV4()),
+		UserID:    userID,
+		Kind:      kind,
+		Status:    jobPending,
+		CreatedAt: time.Now(),
+	}
+	stored := j
+	m.jobs = append(m.jobs, &stored)
+	return j, nil
+}
+
+func (m *MemStore) getAccountJob(jobID uuid.UUID) (AccountJob, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, j := range m.jobs {
+		if j.ID == jobID {
+			return *j, nil
+		}
+	}
+	return AccountJob{}, sql.ErrNoRows
+}
+
+func (m *MemStore) getUnfinishedAccountJobs() []AccountJob {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var jobs []AccountJob
+	for _, j := range m.jobs {
+		if j.Status == jobPending || j.Status == jobRunning {
+			jobs = append(jobs, *j)
+		}
+	}
+	return jobs
+}
+
+func (m *MemStore) setAccountJobStatus(jobID uuid.UUID, status string, jobErr error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, j := range m.jobs {
+		if j.ID != jobID {
+			continue
+		}
+		j.Status = status
+		j.Error = ""
+		if jobErr != nil {
+			j.Error = jobErr.Error()
+		}
+		j.FinishedAt = nil
+		if status == jobDone || status == jobFailed {
+			now := time.Now()
+			j.FinishedAt = &now
+		}
+	}
+}
+
+func (m *MemStore) recordLoginAttempt(a LoginAttempt) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.loginAttempts = append(m.loginAttempts, a)
+}
+
+func (m *MemStore) getUserIDByLogin(login string) (uuid.UUID, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, u := range m.users {
+		if strings.EqualFold(u.Username, login) || strings.EqualFold(u.EmailAddress, login) {
+			return u.UserID, nil
+		}
+	}
+	return uuid.Nil, sql.ErrNoRows
+}
+
+func (m *MemStore) takeLoginAttempt(key string, since time.Time) (int, time.Time, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	t := m.loginThrottle[key]
+	if t == nil || !t.last.After(since) {
+		m.loginThrottle[key] = &memThrottle{failures: 1, last: now}
+		return 0, time.Time{}, nil
+	}
+	failures, last := t.failures, t.last
+	t.failures++
+	t.previous, t.last = t.last, now
+	return failures, last, nil
+}
+
+func (m *MemStore) refundLoginAttempt(key string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if t := m.loginThrottle[key]; t != nil && t.failures > 0 {
+		t.failures--
+		if !t.previous.IsZero() {
+			t.last = t.previous
+		}
+	}
+}
+
+func (m *MemStore) clearLoginFailures(key string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.loginThrottle, key)
+}
+
+func (m *MemStore) pruneLoginAttempts(before, idleSince time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	kept := m.loginAttempts[:0]
+	for _, a := range m.loginAttempts {
+		if !a.CreatedAt.Before(before) {
+			kept = append(kept, a)
+		}
+	}
+	m.loginAttempts = kept
+	for key, t := range m.loginThrottle {
+		if t.last.Before(idleSince) {
+			delete(m.loginThrottle, key)
+		}
+	}
+	return nil
+}
+
+func (m *MemStore) getTOTP(userID uuid.UUID) (string, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u := m.user(userID)
+	if u == nil {
+		return "", false, sql.ErrNoRows
+	}
+	return u.totpSecret, u.TOTPEnabled, nil
+}
+
+func (m *MemStore) setTOTPSecret(userID uuid.UUID, secret string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u := m.user(userID)
+	if u == nil || u.TOTPEnabled {
+		return false, nil
+	}
+	u.totpSecret = secret
+	u.totpLastStep = 0
+	return true, nil
+}
+
+func (m *MemStore) useTOTPStep(userID uuid.UUID, step int64) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u := m.user(userID)
+	if u == nil || u.totpLastStep >= step {
+		return false
+	}
+	u.totpLastStep = step
+	return true
+}
+
+func (m *MemStore) enableTOTP(userID uuid.UUID, recoveryHashes []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if u := m.user(userID); u != nil && u.totpSecret != "" {
+		u.TOTPEnabled = true
+	}
+	codes := map[string]bool{}
+	for _, h := range recoveryHashes {
+		codes[h] = false
+	}
+	m.recoveryCodes[userID] = codes
+	return nil
+}
+
+func (m *MemStore) disableTOTP(userID uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if u := m.user(userID); u != nil {
+		u.totpSecret = ""
+		u.TOTPEnabled = false
+		u.totpLastStep = 0
+	}
+	delete(m.recoveryCodes, userID)
+	return nil
+}
+
+func (m *MemStore) useRecoveryCode(userID uuid.UUID, codeHash string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	used, ok := m.recoveryCodes[userID][codeHash]
+	if !ok || used {
+		return false
+	}
+	m.recoveryCodes[userID][codeHash] = true
+	return true
+}
+
+func (m *MemStore) getOAuthIdentity(provider, subject string) (uuid.UUID, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if userID, ok := m.oauth[[2]string{provider, subject}]; ok {
+		return userID, nil
+	}
+	return uuid.Nil, sql.ErrNoRows
+}
+
+func (m *MemStore) linkOAuthIdentity(provider, subject string, userID uuid.UUID, email string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := [2]string{provider, subject}
+	if _, ok := m.oauth[key]; ok {
+		return errNotUnique
+	}
+	m.oauth[key] = userID
+	return nil
+}
+
+func (m *MemStore) createOAuthUser(u User, provider, subject, email string) (User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := [2]string{provider, subject}
+	if _, ok := m.oauth[key]; ok {
+		return u, errNotUnique
+	}
+	u, err := m.addUser(u)
+	if err != nil {
+		return u, err
+	}
+	m.oauth[key] = u.UserID
+	return u, nil
+}
+
+func (m *MemStore) createAPIToken(t APIToken, tokenHash string) (APIToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t.ID = uuid.Must(uuid.NewV4())
+	t.CreatedAt = time.Now()
+	for _, other := range m.apiTokens {
+		if other.hash == tokenHash {
+			return t, errNotUnique
+		}
+	}
+	stored := t
+	stored.Scopes = append([]string(nil), t.Scopes...)
+	stored.Token = ""
+	m.apiTokens = append(m.apiTokens, &memAPIToken{APIToken: stored, hash: tokenHash})
+	return t, nil
+}
+
+func (m *MemStore) getAPITokens(userID uuid.UUID) []APIToken {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	tokens := []APIToken{}
+	for i := len(m.apiTokens) - 1; i >= 0; i-- {
+		t := m.apiTokens[i]
+		if t.UserID == userID && !t.revoked {
+			token := t.APIToken
+			token.Scopes = append([]string(nil), t.Scopes...)
+			tokens = append(tokens, token)
+		}
+	}
+	return tokens
+}
+
+func (m *MemStore) useAPIToken(tokenHash string) (APIToken, User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, t := range m.apiTokens {
+		if t.hash != tokenHash || t.revoked {
+			continue
+		}
+		u := m.user(t.UserID)
+		if u == nil {
+			break
+		}
+		now := time.Now()
+		t.LastUsedAt = &now
+		token := t.APIToken
+		token.Scopes = append([]string(nil), t.Scopes...)
+		return token, User{
+			UserID:       u.UserID,
+			Username:     u.Username,
+			EmailAddress: u.EmailAddress,
+		}, nil
+	}
+	return APIToken{}, User{}, sql.ErrNoRows
+}
+
+func (m *MemStore) revokeAPIToken(userID, tokenID uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, t := range m.apiTokens {
+		if t.ID == tokenID && t.UserID == userID && !t.revoked {
+			t.revoked = true
+			return nil
+		}
+	}
+	return sql.ErrNoRows
+}
@@ -0,0 +1,133 @@
+package showcash
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// confusables folds look-alike letters from other scripts into the latin
+// letters people are pretending they are
+var confusables = map[rune]rune{
+	// Cyrillic
+	'а': 'a', 'в': 'b', 'е': 'e', 'ё': 'e', 'к': 'k', 'м': 'm', 'н': 'h',
+	'о': 'o', 'р': 'p', 'с': 'c', 'т': 't', 'у': 'y', 'х': 'x', 'і': 'i',
+	'ї': 'i', 'ј': 'j', 'ѕ': 's', 'ԁ': 'd', 'ԛ': 'q', 'ԝ': 'w', 'г': 'r',
+	// Greek
+	'α': 'a', 'β': 'b', 'γ': 'y', 'ε': 'e', 'η': 'n', 'ι': 'i', 'κ': 'k',
+	'ν': 'v', 'ο': 'o', 'ρ': 'p', 'τ': 't', 'υ': 'u', 'χ': 'x', 'ω': 'w',
+	// Everything else
+	'ı': 'i', 'ł': 'l', 'ø': 'o', 'đ': 'd', 'ß': 's', 'ŀ': 'l',
+}
+
+// leetspeak maps the usual number and symbol swaps back to letters
+var leetspeak = map[rune]rune{
+	'0': 'o', '1': 'i', '3': 'e', '4': 'a', '5': 's', '7': 't', '8': 'b',
+	'9': 'g', '@': 'a', '$': 's', '!': 'i', '|': 'l', '+': 't',
+}
+
+// foldText lower cases s after NFKC compatibility folding (full width,
+// ligatures, super/subscripts), drops accents and invisible formatting
+// characters and folds confusable letters
+func foldText(s string) string {
+	var b strings.Builder
+	b.Grow(len(s))
+	for _, r := range norm.NFKD.String(s) {
+		if unicode.Is(unicode.Mn, r) || unicode.Is(unicode.Cf, r) {
+			// Combining accents, zero width joiners, soft hyphens etc.
+			continue
+		}
+		r = unicode.ToLower(r)
+		if c, ok := confusables[r]; ok {
+			r = c
+		}
+		b.WriteRune(r)
+	}
+	return norm.NFKC.String(b.String())
+}
+
+// unleet undoes leetspeak, but only inside words that also contain a letter
+// so plain numbers and punctuation are left alone
+func unleet(s string) string {
+	out := []rune(s)
+	start := -1
+	for i := 0; i <= len(out); i++ {
+		if i < len(out) && (isLetterOrDigit(out[i]) || leetspeak[out[i]] != 0) {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		if start >= 0 && hasLetter(out[start:i]) {
+			for j := start; j < i; j++ {
+				if l, ok := leetspeak[out[j]]; ok {
+					out[j] = l
+				}
+			}
+		}
+		start = -1
+	}
+	return string(out)
+}
+
+// collapseSpacing joins runs of three or more single characters split up
+// by separators so "c u n t" and "c.u.n.t" become "cunt"
+func collapseSpacing(s string) string {
+	fields := strings.FieldsFunc(s, func(r rune) bool {
+		return !isLetterOrDigit(r) && leetspeak[r] == 0
+	})
+	var b strings.Builder
+	for i := 0; i < len(fields); {
+		j := i
+		for j < len(fields) && len([]rune(fields[j])) == 1 {
+			j++
+		}
+		if j-i >= 3 {
+			b.WriteString(strings.Join(fields[i:j], ""))
+			b.WriteByte(' ')
+			i = j
+			continue
+		}
+		if j == i {
+			j++
+		}
+		b.WriteString(strings.Join(fields[i:j], " "))
+		b.WriteByte(' ')
+		i = j
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// normalisedVariants is every version of s we check against the rules -
+// the folded text first so hits still point at something recognisable
+func normalisedVariants(s string) []string {
+	folded := foldText(s)
+	variants := []string{folded}
+	add := func(v string) {
+		for i := range variants {
+			if variants[i] == v {
+				return
+			}
+		}
+		variants = append(variants, v)
+	}
+	add(unleet(folded))
+	collapsed := collapseSpacing(folded)
+	add(collapsed)
+	add(unleet(collapsed))
+	return variants
+}
+
+func isLetterOrDigit(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func hasLetter(rs []rune) bool {
+	for _, r := range rs {
+		if unicode.IsLetter(r) {
+			return true
+		}
+	}
+	return false
+}
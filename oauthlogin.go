@@ -0,0 +1,383 @@
+package showcash
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/17twenty/showcash-api/pkg/oauth"
+	"github.com/gofrs/uuid"
+	"github.com/gorilla/mux"
+	"github.com/gorilla/securecookie"
+)
+
+const (
+	// oauthStateTTL is how long someone has to sign in at the provider
+	oauthStateTTL = 10 * time.Minute
+	// oauthSignupTTL is how long someone has to pick a username
+	oauthSignupTTL = 30 * time.Minute
+)
+
+var (
+	oauthStateCodec  = securecookie.New(hashKey, blockKey).MaxAge(int(oauthStateTTL.Seconds()))
+	oauthSignupCodec = securecookie.New(hashKey, blockKey).MaxAge(int(oauthSignupTTL.Seconds()))
+)
+
+// oauthState ties the callback to the browser that started the login
+type oauthState struct {
+	Provider string
+	State    string
+}
+
+// oauthSignup carries who the provider said they were through to picking
+// a username
+type oauthSignup struct {
+	Provider      string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	Username      string
+}
+
+// oauthLink is a provider login waiting for the owner of the account with
+// the same, unverified, email to log in with their password
+type oauthLink struct {
+	Provider string
+	Subject  string
+	Email    string
+	UserID   uuid.UUID
+}
+
+// errOAuthNeedsPassword is when a provider login matches an account that
+// hasn't verified its email, so the provider's word isn't enough
+var errOAuthNeedsPassword = errors.New("account email is unverified, log in with the password to link")
+
+// oauthLogin is what a provider login shows up as in the login audit
+func oauthLogin(provider, subject string) string {
+	return provider + ":" + subject
+}
+
+// oauthRedirect sends the browser back to the frontend
+func (c *Core) oauthRedirect(wr http.ResponseWriter, req *http.Request, path string, q url.Values) {
+	target := c.siteURL + path
+	if len(q) > 0 {
+		target += "?" + q.Encode()
+	}
+	http.Redirect(wr, req, target, http.StatusFound)
+}
+
+// handOffCookie carries a token from the callback to the next step of
+// logging in. Unlike a query string it stays out of browser history,
+// server logs and Referer headers.
+func handOffCookie(name, value, path string, ttl time.Duration) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		MaxAge:   int(ttl.Seconds()),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+func (c *Core) oauthFailed(wr http.ResponseWriter, req *http.Request, reason string) {
+	c.oauthRedirect(wr, req, "/login", url.Values{"oauth_error": {reason}})
+}
+
+// apiGetOAuthStart sends the user off to sign in with the provider
+func (c *Core) apiGetOAuthStart(wr http.ResponseWriter, req *http.Request) {
+	p, ok := c.oauthProviders[mux.Vars(req)["provider"]]
+	if !ok {
+		apiNotFoundError.write(wr)
+		return
+	}
+
+	state, err := randomString(24)
+	if err != nil {
+		log.Println("apiGetOAuthStart().randomString failed", err)
+		apiServerError.write(wr)
+		return
+	}
+	encoded, err := oauthStateCodec.Encode("showcash-oauth", oauthState{Provider: p.Name, State: state})
+	if err != nil {
+		log.Println("apiGetOAuthStart().Encode failed", err)
+		apiServerError.write(wr)
+		return
+	}
+	http.SetCookie(wr, &http.Cookie{
+		Name:     "showcash-oauth",
+		Value:    encoded,
+		Path:     "/auth/oauth/",
+		MaxAge:   int(oauthStateTTL.Seconds()),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode, // it has to survive the redirect back
+	})
+	http.Redirect(wr, req, p.AuthCodeURL(state), http.StatusFound)
+}
+
+// apiGetOAuthCallback is where the provider sends the user back to. They
+// get logged in, linked by verified email, asked for their password to link
+// to an unverified one, or sent off to pick a username.
+func (c *Core) apiGetOAuthCallback(wr http.ResponseWriter, req *http.Request) {
+	p, ok := c.oauthProviders[mux.Vars(req)["provider"]]
+	if !ok {
+		apiNotFoundError.write(wr)
+		return
+	}
+
+	st := oauthState{}
+	cookie, err := req.Cookie("showcash-oauth")
+	if err == nil {
+		err = oauthStateCodec.Decode("showcash-oauth", cookie.Value, &st)
+	}
+	http.SetCookie(wr, &http.Cookie{Name: "showcash-oauth", Path: "/auth/oauth/", MaxAge: -1})
+	state := req.URL.Query().Get("state")
+	if err != nil || st.Provider != p.Name || subtle.ConstantTimeCompare([]byte(st.State), []byte(state)) != 1 {
+		c.oauthFailed(wr, req, "expired")
+		return
+	}
+	if req.URL.Query().Get("error") != "" {
+		c.oauthFailed(wr, req, "denied")
+		return
+	}
+
+	token, err := p.Exchange(req.Context(), req.URL.Query().Get("code"))
+	if err != nil {
+		log.Println("apiGetOAuthCallback().Exchange failed", err)
+		c.oauthFailed(wr, req, "provider")
+		return
+	}
+	id, err := p.Identity(req.Context(), token)
+	if err != nil {
+		log.Println("apiGetOAuthCallback().Identity failed", err)
+		c.oauthFailed(wr, req, "provider")
+		return
+	}
+
+	userID, err := c.oauthUser(p.Name, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.oauthStartSignup(wr, req, p.Name, id)
+		return
+	} else if errors.Is(err, errOAuthNeedsPassword) {
+		c.oauthStartLink(wr, req, oauthLink{Provider: p.Name, Subject: id.Subject, Email: id.Email, UserID: userID})
+		return
+	} else if err != nil {
+		log.Println("apiGetOAuthCallback().oauthUser failed", err)
+		c.oauthFailed(wr, req, "server")
+		return
+	}
+
+	user, err := c.dao.getLoginUser(userID)
+	if err != nil {
+		log.Println("apiGetOAuthCallback().getLoginUser failed", err)
+		c.oauthFailed(wr, req, "server")
+		return
+	}
+	login := oauthLogin(p.Name, id.Subject)
+	if user.TOTPEnabled {
+		c.recordLogin(req, login, user.UserID, loginTwoFactor)
+		token, err := twoFactorCodec.Encode("showcash-2fa", pendingLogin{UserID: user.UserID, Login: login})
+		if err != nil {
+			log.Println("apiGetOAuthCallback().Encode failed", err)
+			c.oauthFailed(wr, req, "server")
+			return
+		}
+		http.SetCookie(wr, handOffCookie("showcash-2fa", token, "/auth/login/2fa", twoFactorLoginTTL))
+		c.oauthRedirect(wr, req, "/login/2fa", nil)
+		return
+	}
+
+	c.recordLogin(req, login, user.UserID, loginOK)
+	if user.SessionEpoch, err = c.dao.getSessionEpoch(user.UserID); err != nil {
+		log.Println("apiGetOAuthCallback().getSessionEpoch failed", err)
+	}
+	setUserCookie(wr, user)
+	c.oauthRedirect(wr, req, "/", nil)
+}
+
+// oauthUser finds the user a provider identity belongs to, linking it to
+// the account with the same email when both the provider and the account
+// have verified it
+func (c *Core) oauthUser(provider string, id oauth.Identity) (uuid.UUID, error) {
+	userID, err := c.dao.getOAuthIdentity(provider, id.Subject)
+	if !errors.Is(err, sql.ErrNoRows) {
+		return userID, err
+	}
+	if id.Email == "" || !id.EmailVerified {
+		return uuid.Nil, sql.ErrNoRows
+	}
+
+	existing, err := c.dao.getUserByEmail(id.Email)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	// Anyone can sign up with an address they don't own, so until the
+	// account proves it does the password has to come first
+	if !c.dao.isEmailVerified(existing.UserID) {
+		return existing.UserID, errOAuthNeedsPassword
+	}
+	if err := c.dao.linkOAuthIdentity(provider, id.Subject, existing.UserID, id.Email); err != nil {
+		return uuid.Nil, err
+	}
+	log.Println("Linked", provider, "login to", existing.Username)
+	return existing.UserID, nil
+}
+
+// oauthStartLink sends the user to log in with their password, which
+// finishes linking the provider login
+func (c *Core) oauthStartLink(wr http.ResponseWriter, req *http.Request, link oauthLink) {
+	encoded, err := oauthStateCodec.Encode("showcash-oauth-link", link)
+	if err != nil {
+		log.Println("oauthStartLink().Encode failed", err)
+		c.oauthFailed(wr, req, "server")
+		return
+	}
+	http.SetCookie(wr, handOffCookie("showcash-oauth-link", encoded, "/auth/login", oauthStateTTL))
+	c.oauthFailed(wr, req, "link_required")
+}
+
+// finishOAuthLink links the provider login waiting from oauthStartLink
+// once its account has logged in
+func (c *Core) finishOAuthLink(wr http.ResponseWriter, req *http.Request, userID uuid.UUID) {
+	cookie, err := req.Cookie("showcash-oauth-link")
+	if err != nil {
+		return
+	}
+	http.SetCookie(wr, &http.Cookie{Name: "showcash-oauth-link", Path: "/auth/login", MaxAge: -1})
+
+	link := oauthLink{}
+	if err := oauthStateCodec.Decode("showcash-oauth-link", cookie.Value, &link); err != nil || link.UserID != userID {
+		return
+	}
+	if err := c.dao.linkOAuthIdentity(link.Provider, link.Subject, userID, link.Email); err != nil {
+		log.Println("finishOAuthLink().linkOAuthIdentity failed", err)
+		return
+	}
+	log.Println("Linked", link.Provider, "login to", userID)
+}
+
+// oauthStartSignup sends a new user to the frontend to pick a username,
+// suggesting the one they use at the provider
+func (c *Core) oauthStartSignup(wr http.ResponseWriter, req *http.Request, provider string, id oauth.Identity) {
+	token, err := oauthSignupCodec.Encode("showcash-oauth-signup", oauthSignup{
+		Provider:      provider,
+		Subject:       id.Subject,
+		Email:         id.Email,
+		EmailVerified: id.EmailVerified,
+		Name:          id.Name,
+		Username:      id.Username,
+	})
+	if err != nil {
+		log.Println("oauthStartSignup().Encode failed", err)
+		c.oauthFailed(wr, req, "server")
+		return
+	}
+
+	suggested := id.Username
+	if suggested == "" {
+		suggested = strings.SplitN(id.Email, "@", 2)[0]
+	}
+	if validateUsername(suggested) != nil {
+		suggested = ""
+	}
+	http.SetCookie(wr, handOffCookie("showcash-oauth-signup", token, "/auth/oauth/signup", oauthSignupTTL))
+	q := url.Values{}
+	if suggested != "" {
+		q.Set("username", suggested)
+	}
+	if id.Email != "" {
+		q.Set("email_address", id.Email)
+	}
+	c.oauthRedirect(wr, req, "/oauth/signup", q)
+}
+
+// apiPostOAuthSignup creates the account for a new provider login once
+// they've picked a username
+func (c *Core) apiPostOAuthSignup(wr http.ResponseWriter, req *http.Request) {
+	payload := struct {
+		Username     string `json:"username"`
+		EmailAddress string `json:"email_address"` // only used when the provider doesn't share one
+	}{}
+	if err := json.NewDecoder(req.Body).Decode(&payload); err != nil {
+		log.Println("apiPostOAuthSignup.Decode() failed", err)
+		apiBadJSONError.write(wr)
+		return
+	}
+
+	su := oauthSignup{}
+	cookie, err := req.Cookie("showcash-oauth-signup")
+	if err == nil {
+		err = oauthSignupCodec.Decode("showcash-oauth-signup", cookie.Value, &su)
+	}
+	if err != nil {
+		apiUnauthorizedError.withCode("expired").withMessage("That sign up has expired, start again").write(wr)
+		return
+	}
+
+	newUser := User{
+		Username:     strings.TrimSpace(payload.Username),
+		EmailAddress: su.Email,
+	}
+	if newUser.EmailAddress == "" {
+		newUser.EmailAddress = strings.TrimSpace(payload.EmailAddress)
+	}
+	// Whatever the provider calls them is a bonus, not something to fix
+	if validateProfile(User{RealName: su.Name}) == nil {
+		newUser.RealName = su.Name
+	}
+	if su.Provider == "instagram" && validateProfile(User{Social1: su.Username}) == nil {
+		newUser.Social1 = su.Username
+	}
+
+	// Same checks as apiPostSignup
+	if err := validateSignup(newUser); err != nil {
+		validationResponse(wr, err)
+		return
+	}
+	c.canonicaliseUser(&newUser)
+	if c.dao.isUsernameReserved(newUser.Username) {
+		apiAccountExistsError.write(wr)
+		return
+	}
+
+	// They log in through the provider, a password can be set with a reset
+	if newUser.Password, err = randomString(32); err != nil {
+		log.Println("apiPostOAuthSignup().randomString failed", err)
+		apiServerError.write(wr)
+		return
+	}
+	// The account and its link go in together, so reusing the token can't
+	// make a second account for the same login
+	result, err := c.dao.createOAuthUser(newUser, su.Provider, su.Subject, su.Email)
+	if pgErrIs(err, errNotUnique) {
+		apiAccountExistsError.write(wr)
+		return
+	} else if err != nil {
+		log.Println("apiPostOAuthSignup().createOAuthUser failed", err)
+		apiServerError.write(wr)
+		return
+	}
+	http.SetCookie(wr, &http.Cookie{Name: "showcash-oauth-signup", Path: "/auth/oauth/signup", MaxAge: -1})
+	if su.Email != "" && su.EmailVerified && su.Email == result.EmailAddress {
+		if err := c.dao.setEmailVerified(result.UserID, result.EmailAddress); err != nil {
+			log.Println("apiPostOAuthSignup().setEmailVerified failed", err)
+		}
+	} else if err := c.sendVerification(result.UserID, result.Username, result.EmailAddress); err != nil {
+		log.Println("apiPostOAuthSignup().sendVerification failed", err)
+	}
+
+	user, err := c.dao.getLoginUser(result.UserID)
+	if err != nil {
+		log.Println("apiPostOAuthSignup().getLoginUser failed", err)
+		apiServerError.write(wr)
+		return
+	}
+	c.completeLogin(wr, req, oauthLogin(su.Provider, su.Subject), user)
+}
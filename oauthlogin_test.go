@@ -0,0 +1,229 @@
+package showcash
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/17twenty/showcash-api/pkg/oauth"
+)
+
+// mockOIDC is an OpenID Connect provider that signs in whoever claims
+// says, as if they'd just logged in there
+type mockOIDC struct {
+	*httptest.Server
+	claims map[string]interface{}
+}
+
+func newMockOIDC() *mockOIDC {
+	m := &mockOIDC{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(wr http.ResponseWriter, req *http.Request) {
+		if req.FormValue("code") != "good-code" {
+			wr.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(wr).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		json.NewEncoder(wr).Encode(map[string]string{"access_token": "at-123", "token_type": "Bearer"})
+	})
+	mux.HandleFunc("/userinfo", func(wr http.ResponseWriter, req *http.Request) {
+		json.NewEncoder(wr).Encode(m.claims)
+	})
+	m.Server = httptest.NewServer(mux)
+	return m
+}
+
+func (m *mockOIDC) provider(name string) *oauth.Provider {
+	return &oauth.Provider{
+		Name:         name,
+		Kind:         oauth.KindOIDC,
+		ClientID:     "client",
+		ClientSecret: "shh",
+		RedirectURL:  "http://localhost:8080/auth/oauth/" + name + "/callback",
+		AuthURL:      m.URL + "/authorize",
+		TokenURL:     m.URL + "/token",
+		UserInfoURL:  m.URL + "/userinfo",
+		Scopes:       []string{"openid", "email"},
+	}
+}
+
+// oauthSignIn logs a in with provider, returning where the callback sent
+// the browser
+func (a *apiClient) oauthSignIn(provider string) *url.URL {
+	a.client.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	defer func() { a.client.CheckRedirect = nil }()
+
+	resp, err := a.client.Get(a.srv.URL + "/auth/oauth/" + provider)
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	resp.Body.Close()
+	start, err := resp.Location()
+	if err != nil {
+		a.t.Fatal("no redirect to the provider", err)
+	}
+
+	resp, err = a.client.Get(a.srv.URL + "/auth/oauth/" + provider + "/callback?code=good-code&state=" + url.QueryEscape(start.Query().Get("state")))
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	resp.Body.Close()
+	back, err := resp.Location()
+	if err != nil {
+		a.t.Fatal("no redirect back to the site", err)
+	}
+	return back
+}
+
+func TestCore_OAuthLinking(t *testing.T) {
+	mock := newMockOIDC()
+	defer mock.Close()
+	store := NewMemStore()
+	srv := httptest.NewServer(New(store, WithSiteURL("https://showcash.io"), WithOAuthProviders(mock.provider("mock"))).Handler())
+	defer srv.Close()
+
+	// Someone signs up with an address they don't own...
+	squatter := User{Username: "Sam", EmailAddress: "sam@example.com", Password: "squatters pass"}
+	if got := newAPIClient(t, srv).do(http.MethodPost, "/auth/register", squatter, nil); got != http.StatusOK {
+		t.Fatalf("register = %d", got)
+	}
+	// ...then the real owner signs in with the provider
+	mock.claims = map[string]interface{}{"sub": "sam-1", "email": "sam@example.com", "email_verified": true}
+	sam := newAPIClient(t, srv)
+	if got := sam.oauthSignIn("mock"); got.Path != "/login" || got.Query().Get("oauth_error") != "link_required" {
+		t.Errorf("signing in over an unverified account went to %s", got)
+	}
+	if _, err := store.getOAuthIdentity("mock", "sam-1"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("provider login linked to an unverified account, err %v", err)
+	}
+	if got := sam.do(http.MethodGet, "/api/profile", nil, nil); got != http.StatusUnauthorized {
+		t.Errorf("profile after being asked for a password = %d, want %d", got, http.StatusUnauthorized)
+	}
+
+	// Whoever knows the password finishes the link by logging in
+	login := map[string]string{"username": "Sam", "password": "squatters pass"}
+	if got := sam.do(http.MethodPost, "/auth/login", login, nil); got != http.StatusOK {
+		t.Fatalf("login = %d", got)
+	}
+	samID, _ := store.getUserIDByHandle("Sam")
+	if got, err := store.getOAuthIdentity("mock", "sam-1"); err != nil || got != samID {
+		t.Errorf("password login didn't finish the link, got %v %v", got, err)
+	}
+	if store.isEmailVerified(samID) {
+		t.Error("linking verified the account's email")
+	}
+
+	// A verified account is linked straight away
+	alex := newAPIClient(t, srv)
+	if got := alex.do(http.MethodPost, "/auth/register", User{Username: "Alex", EmailAddress: "alex@example.com", Password: "alexs pass"}, nil); got != http.StatusOK {
+		t.Fatalf("register = %d", got)
+	}
+	alexID, _ := store.getUserIDByHandle("Alex")
+	if err := store.setEmailVerified(alexID, "alex@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	mock.claims = map[string]interface{}{"sub": "alex-1", "email": "alex@example.com", "email_verified": true}
+	alexElsewhere := newAPIClient(t, srv)
+	if got := alexElsewhere.oauthSignIn("mock"); got.Path != "/" {
+		t.Errorf("signing in over a verified account went to %s", got)
+	}
+	profile := UserProfile{}
+	if got := alexElsewhere.do(http.MethodGet, "/api/profile", nil, &profile); got != http.StatusOK || profile.Username != "Alex" {
+		t.Errorf("profile after linking = %d %+v", got, profile)
+	}
+
+	// And nobody else's email means a new account
+	mock.claims = map[string]interface{}{"sub": "kim-1", "email": "kim@example.com", "email_verified": true}
+	if got := newAPIClient(t, srv).oauthSignIn("mock"); got.Path != "/oauth/signup" {
+		t.Errorf("signing in with a new email went to %s", got)
+	}
+}
+
+func TestCore_OAuthSignup(t *testing.T) {
+	mock := newMockOIDC()
+	defer mock.Close()
+	store := NewMemStore()
+	srv := httptest.NewServer(New(store, WithSiteURL("https://showcash.io"), WithOAuthProviders(mock.provider("mock"))).Handler())
+	defer srv.Close()
+
+	// Like Instagram, no email
+	mock.claims = map[string]interface{}{"sub": "pat-1", "preferred_username": "pat"}
+	pat := newAPIClient(t, srv)
+	back := pat.oauthSignIn("mock")
+	if back.Path != "/oauth/signup" || back.Query().Get("username") != "pat" || back.Query().Get("token") != "" {
+		t.Fatalf("signing in for the first time went to %s", back)
+	}
+	// The signup token stays out of the URL
+	signupURL, _ := url.Parse(srv.URL + "/auth/oauth/signup")
+	token := pat.client.Jar.Cookies(signupURL)
+
+	signup := map[string]string{"username": "Pat", "email_address": "pat@example.com"}
+	user := User{}
+	if got := pat.do(http.MethodPost, "/auth/oauth/signup", signup, &user); got != http.StatusOK || user.Username != "Pat" {
+		t.Fatalf("signup = %d %+v", got, user)
+	}
+	if got, err := store.getOAuthIdentity("mock", "pat-1"); err != nil || got != user.UserID {
+		t.Errorf("signup didn't link the login, got %v %v", got, err)
+	}
+
+	if got := pat.do(http.MethodPost, "/auth/oauth/signup", signup, nil); got != http.StatusUnauthorized {
+		t.Errorf("signing up again from the same browser = %d, want %d", got, http.StatusUnauthorized)
+	}
+
+	// The token is good for a while, but not for a second account
+	replay := newAPIClient(t, srv)
+	replay.client.Jar.SetCookies(signupURL, token)
+	again := map[string]string{"username": "Patricia", "email_address": "patricia@example.com"}
+	if got := replay.do(http.MethodPost, "/auth/oauth/signup", again, nil); got != http.StatusConflict {
+		t.Errorf("signing up twice with one login = %d, want %d", got, http.StatusConflict)
+	}
+	if _, err := store.getUserIDByHandle("Patricia"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("the second signup left an account behind, err %v", err)
+	}
+}
+
+func TestCore_OAuthTwoFactor(t *testing.T) {
+	mock := newMockOIDC()
+	defer mock.Close()
+	store := NewMemStore()
+	srv := httptest.NewServer(New(store, WithSiteURL("https://showcash.io"), WithOAuthProviders(mock.provider("mock"))).Handler())
+	defer srv.Close()
+
+	user := newTestUser(t, store, "Lee")
+	secret := totpEncoding.EncodeToString([]byte("12345678901234567890"))
+	if _, err := store.setTOTPSecret(user.UserID, secret); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.enableTOTP(user.UserID, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.linkOAuthIdentity("mock", "lee-1", user.UserID, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	mock.claims = map[string]interface{}{"sub": "lee-1"}
+	lee := newAPIClient(t, srv)
+	if got := lee.oauthSignIn("mock"); got.Path != "/login/2fa" || got.RawQuery != "" {
+		t.Errorf("signing in with 2FA on went to %s", got)
+	}
+
+	key, _ := totpEncoding.DecodeString(secret)
+	code := map[string]string{"code": hotp(key, totpStep(time.Now()))}
+	logged := User{}
+	if got := lee.do(http.MethodPost, "/auth/login/2fa", code, &logged); got != http.StatusOK || logged.Username != "Lee" {
+		t.Fatalf("2FA step = %d %+v", got, logged)
+	}
+	if got := lee.do(http.MethodGet, "/api/profile", nil, nil); got != http.StatusOK {
+		t.Errorf("profile after 2FA = %d", got)
+	}
+	if got := newAPIClient(t, srv).do(http.MethodPost, "/auth/login/2fa", code, nil); got != http.StatusUnauthorized {
+		t.Errorf("2FA step from another browser = %d, want %d", got, http.StatusUnauthorized)
+	}
+}
@@ -0,0 +1,88 @@
+package showcash
+
+import (
+	"strings"
+	"time"
+
+	"github.com/17twenty/showcash-api/pkg/mailer"
+	"github.com/17twenty/showcash-api/pkg/oauth"
+)
+
+// Option changes how New sets up the Core
+type Option func(*Core)
+
+// WithS3 stores uploads in S3 instead of the local static folder
+func WithS3() Option {
+	return func(c *Core) {
+		c.useS3 = true
+	}
+}
+
+// WithReportThreshold is how many reports a post, comment or user can
+// receive before it is hidden - zero disables hiding
+func WithReportThreshold(n int) Option {
+	return func(c *Core) {
+		c.reportThreshold = n
+	}
+}
+
+// WithFilterRules loads extra content filter rules from a file
+func WithFilterRules(file string) Option {
+	return func(c *Core) {
+		c.filterRulesFile = file
+	}
+}
+
+// WithAffiliateStripping removes affiliate and tracking parameters from
+// links people post
+func WithAffiliateStripping(strip bool) Option {
+	return func(c *Core) {
+		c.stripAffiliateTags = strip
+	}
+}
+
+// WithMailer sends email through m instead of logging it
+func WithMailer(m mailer.Mailer) Option {
+	return func(c *Core) {
+		c.mailer = m
+	}
+}
+
+// WithSiteURL is the frontend address used in links we send
+func WithSiteURL(siteURL string) Option {
+	return func(c *Core) {
+		c.siteURL = strings.TrimSuffix(siteURL, "/")
+	}
+}
+
+// WithLoginLockout locks a login out for lockout after maxFailures bad
+// passwords in a row - zero failures only slows them down
+func WithLoginLockout(maxFailures int, lockout time.Duration) Option {
+	return func(c *Core) {
+		c.loginPolicy = newLoginPolicy(maxFailures, lockout)
+	}
+}
+
+// WithOAuthProviders offers logins under /auth/oauth/{name}
+func WithOAuthProviders(providers ...*oauth.Provider) Option {
+	return func(c *Core) {
+		for _, p := range providers {
+			c.oauthProviders[p.Name] = p
+		}
+	}
+}
+
+// WithCORS replaces DefaultCORSConfig()
+func WithCORS(cors CORSConfig) Option {
+	return func(c *Core) {
+		c.cors = cors
+	}
+}
+
+// WithTrustedProxies believes X-Forwarded-For from these addresses or
+// CIDR ranges, so throttling sees the client rather than the load balancer
+func WithTrustedProxies(addrs ...string) Option {
+	return func(c *Core) {
+		c.trustedProxies = parseTrustedProxies(addrs)
+	}
+}
@@ -0,0 +1,89 @@
+package mailer
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/smtp"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Mailer sends plain text email
+type Mailer interface {
+	Send(to, subject, body string) error
+}
+
+// New returns an SMTP mailer, or a Log mailer when no host is set so
+// development doesn't need a mail server
+func New(host string, port int, username, password, from string) Mailer {
+	if host == "" {
+		return &Log{From: from}
+	}
+	return &SMTP{
+		Host:     host,
+		Port:     port,
+		Username: username,
+		Password: password,
+		From:     from,
+	}
+}
+
+// SMTP sends mail through an SMTP server
+type SMTP struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+}
+
+// Send will send the message
+func (s *SMTP) Send(to, subject, body string) error {
+	var auth smtp.Auth
+	if s.Username != "" {
+		auth = smtp.PlainAuth("", s.Username, s.Password, s.Host)
+	}
+	addr := net.JoinHostPort(s.Host, strconv.Itoa(s.Port))
+	return smtp.SendMail(addr, auth, s.From, []string{to}, message(s.From, to, subject, body))
+}
+
+// Log logs messages instead of sending them and, if Dir is set, writes
+// each one to a .eml file in it
+type Log struct {
+	From string
+	Dir  string
+}
+
+// Send will log the message
+func (l *Log) Send(to, subject, body string) error {
+	log.Println("---------------")
+	log.Println("Mailer: No SMTP host provided, logging message instead")
+	log.Println("To:", to)
+	log.Println("Subject:", subject)
+	log.Println(body)
+	log.Println("---------------")
+	if l.Dir == "" {
+		return nil
+	}
+	name := fmt.Sprintf("%d-%s.eml", time.Now().UnixNano(), strings.Replace(to, "@", "_at_", -1))
+	return ioutil.WriteFile(filepath.Join(l.Dir, filepath.Base(name)), message(l.From, to, subject, body), 0644)
+}
+
+func message(from, to, subject, body string) []byte {
+	// Nobody gets to sneak extra headers in
+	clean := strings.NewReplacer("\r", "", "\n", "")
+	return []byte(strings.Join([]string{
+		"From: " + clean.Replace(from),
+		"To: " + clean.Replace(to),
+		"Subject: " + clean.Replace(subject),
+		"Date: " + time.Now().Format(time.RFC1123Z),
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=UTF-8",
+		"",
+		body,
+	}, "\r\n"))
+}
@@ -0,0 +1,313 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Kinds of provider, which decide how the user's identity is looked up
+const (
+	KindOIDC      = "oidc"
+	KindGitHub    = "github"
+	KindInstagram = "instagram"
+)
+
+// ErrNoIdentity is returned when the provider doesn't say who the user is
+var ErrNoIdentity = errors.New("provider didn't return a user")
+
+// Identity is who a provider says the user is
+type Identity struct {
+	Subject       string // the provider's ID for the user, never changes
+	Email         string
+	EmailVerified bool
+	Name          string
+	Username      string
+	Picture       string
+}
+
+// Provider is an OAuth2 authorization code flow against one provider
+type Provider struct {
+	Name         string
+	Kind         string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	AuthURL      string
+	TokenURL     string
+	UserInfoURL  string
+	EmailsURL    string // GitHub keeps them separately
+	Scopes       []string
+	Client       *http.Client
+}
+
+// Google signs in with Google's OpenID Connect endpoints
+func Google(clientID, clientSecret, redirectURL string) *Provider {
+	return &Provider{
+		Name:         "google",
+		Kind:         KindOIDC,
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		RedirectURL:  redirectURL,
+		AuthURL:      "https://accounts.google.com/o/oauth2/v2/auth",
+		TokenURL:     "https://oauth2.googleapis.com/token",
+		UserInfoURL:  "https://openidconnect.googleapis.com/v1/userinfo",
+		Scopes:       []string{"openid", "email", "profile"},
+	}
+}
+
+// GitHub signs in with a GitHub OAuth app
+func GitHub(clientID, clientSecret, redirectURL string) *Provider {
+	return &Provider{
+		Name:         "github",
+		Kind:         KindGitHub,
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		RedirectURL:  redirectURL,
+		AuthURL:      "https://github.com/login/oauth/authorize",
+		TokenURL:     "https://github.com/login/oauth/access_token",
+		UserInfoURL:  "https://api.github.com/user",
+		EmailsURL:    "https://api.github.com/user/emails",
+		Scopes:       []string{"read:user", "user:email"},
+	}
+}
+
+// Instagram signs in with the Instagram Basic Display API, which never
+// shares an email address
+func Instagram(clientID, clientSecret, redirectURL string) *Provider {
+	return &Provider{
+		Name:         "instagram",
+		Kind:         KindInstagram,
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		RedirectURL:  redirectURL,
+		AuthURL:      "https://api.instagram.com/oauth/authorize",
+		TokenURL:     "https://api.instagram.com/oauth/access_token",
+		UserInfoURL:  "https://graph.instagram.com/me?fields=id,username",
+		Scopes:       []string{"user_profile"},
+	}
+}
+
+// Discover fills in the endpoints of an OpenID Connect provider from its
+// issuer, which is how a self hosted or mock provider gets configured
+func (p *Provider) Discover(ctx context.Context, issuer string) error {
+	doc := struct {
+		AuthorizationEndpoint string `json:"authorization_endpoint"`
+		TokenEndpoint         string `json:"token_endpoint"`
+		UserInfoEndpoint      string `json:"userinfo_endpoint"`
+	}{}
+	wellKnown := strings.TrimSuffix(issuer, "/") + "/.well-known/openid-configuration"
+	if err := p.getJSON(ctx, wellKnown, "", &doc); err != nil {
+		return err
+	}
+	if doc.AuthorizationEndpoint == "" || doc.TokenEndpoint == "" || doc.UserInfoEndpoint == "" {
+		return fmt.Errorf("%s is missing endpoints", wellKnown)
+	}
+	p.Kind = KindOIDC
+	p.AuthURL = doc.AuthorizationEndpoint
+	p.TokenURL = doc.TokenEndpoint
+	p.UserInfoURL = doc.UserInfoEndpoint
+	return nil
+}
+
+// AuthCodeURL is where to send the user to sign in, state comes back
+// untouched on the redirect
+func (p *Provider) AuthCodeURL(state string) string {
+	q := url.Values{}
+	q.Set("response_type", "code")
+	q.Set("client_id", p.ClientID)
+	q.Set("redirect_uri", p.RedirectURL)
+	q.Set("scope", strings.Join(p.Scopes, scopeSeparator(p.Kind)))
+	q.Set("state", state)
+	sep := "?"
+	if strings.Contains(p.AuthURL, "?") {
+		sep = "&"
+	}
+	return p.AuthURL + sep + q.Encode()
+}
+
+func scopeSeparator(kind string) string {
+	if kind == KindInstagram {
+		return ","
+	}
+	return " "
+}
+
+// Exchange swaps the code from the redirect for an access token
+func (p *Provider) Exchange(ctx context.Context, code string) (string, error) {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.RedirectURL)
+	form.Set("client_id", p.ClientID)
+	form.Set("client_secret", p.ClientSecret)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client().Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	token := struct {
+		AccessToken      string `json:"access_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}{}
+	if err := decode(resp, &token); err != nil {
+		return "", err
+	}
+	if token.Error != "" {
+		return "", fmt.Errorf("%s: %s %s", p.Name, token.Error, token.ErrorDescription)
+	}
+	if token.AccessToken == "" {
+		return "", fmt.Errorf("%s: no access token", p.Name)
+	}
+	return token.AccessToken, nil
+}
+
+// Identity asks the provider who the access token belongs to
+func (p *Provider) Identity(ctx context.Context, accessToken string) (Identity, error) {
+	switch p.Kind {
+	case KindGitHub:
+		return p.githubIdentity(ctx, accessToken)
+	case KindInstagram:
+		return p.instagramIdentity(ctx, accessToken)
+	default:
+		return p.oidcIdentity(ctx, accessToken)
+	}
+}
+
+func (p *Provider) oidcIdentity(ctx context.Context, accessToken string) (Identity, error) {
+	claims := struct {
+		Sub               string      `json:"sub"`
+		Email             string      `json:"email"`
+		EmailVerified     interface{} `json:"email_verified"` // some send "true"
+		Name              string      `json:"name"`
+		PreferredUsername string      `json:"preferred_username"`
+		Picture           string      `json:"picture"`
+	}{}
+	if err := p.getJSON(ctx, p.UserInfoURL, accessToken, &claims); err != nil {
+		return Identity{}, err
+	}
+	if claims.Sub == "" {
+		return Identity{}, ErrNoIdentity
+	}
+	return Identity{
+		Subject:       claims.Sub,
+		Email:         claims.Email,
+		EmailVerified: claims.EmailVerified == true || claims.EmailVerified == "true",
+		Name:          claims.Name,
+		Username:      claims.PreferredUsername,
+		Picture:       claims.Picture,
+	}, nil
+}
+
+func (p *Provider) githubIdentity(ctx context.Context, accessToken string) (Identity, error) {
+	user := struct {
+		ID        json.Number `json:"id"`
+		Login     string      `json:"login"`
+		Name      string      `json:"name"`
+		AvatarURL string      `json:"avatar_url"`
+	}{}
+	if err := p.getJSON(ctx, p.UserInfoURL, accessToken, &user); err != nil {
+		return Identity{}, err
+	}
+	if user.ID == "" {
+		return Identity{}, ErrNoIdentity
+	}
+	id := Identity{
+		Subject:  user.ID.String(),
+		Name:     user.Name,
+		Username: user.Login,
+		Picture:  user.AvatarURL,
+	}
+
+	// The email on the profile is whatever they made public, the verified
+	// primary one is only in the list
+	var emails []struct {
+		Email    string `json:"email"`
+		Primary  bool   `json:"primary"`
+		Verified bool   `json:"verified"`
+	}
+	if p.EmailsURL != "" {
+		if err := p.getJSON(ctx, p.EmailsURL, accessToken, &emails); err != nil {
+			return Identity{}, err
+		}
+	}
+	for _, e := range emails {
+		if e.Primary {
+			id.Email = e.Email
+			id.EmailVerified = e.Verified
+		}
+	}
+	return id, nil
+}
+
+func (p *Provider) instagramIdentity(ctx context.Context, accessToken string) (Identity, error) {
+	me := struct {
+		ID       string `json:"id"`
+		Username string `json:"username"`
+	}{}
+	if err := p.getJSON(ctx, p.UserInfoURL, accessToken, &me); err != nil {
+		return Identity{}, err
+	}
+	if me.ID == "" {
+		return Identity{}, ErrNoIdentity
+	}
+	return Identity{
+		Subject:  me.ID,
+		Username: me.Username,
+	}, nil
+}
+
+func (p *Provider) getJSON(ctx context.Context, endpoint, accessToken string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if accessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+	}
+	resp, err := p.client().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return decode(resp, v)
+}
+
+func (p *Provider) client() *http.Client {
+	if p.Client != nil {
+		return p.Client
+	}
+	return defaultClient
+}
+
+var defaultClient = &http.Client{Timeout: 10 * time.Second}
+
+// decode reads a JSON response, treating anything but a 200 as an error
+func decode(resp *http.Response, v interface{}) error {
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s: %s", resp.Request.URL.Host, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return json.Unmarshal(body, v)
+}
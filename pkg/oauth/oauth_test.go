@@ -0,0 +1,121 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// mockOIDC is a provider that hands out one code and one access token
+func mockOIDC(t *testing.T) *httptest.Server {
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	mux.HandleFunc("/.well-known/openid-configuration", func(wr http.ResponseWriter, req *http.Request) {
+		json.NewEncoder(wr).Encode(map[string]string{
+			"issuer":                 srv.URL,
+			"authorization_endpoint": srv.URL + "/authorize",
+			"token_endpoint":         srv.URL + "/token",
+			"userinfo_endpoint":      srv.URL + "/userinfo",
+		})
+	})
+	mux.HandleFunc("/token", func(wr http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost || req.FormValue("code") != "good-code" ||
+			req.FormValue("client_secret") != "shh" || req.FormValue("grant_type") != "authorization_code" {
+			wr.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(wr).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		json.NewEncoder(wr).Encode(map[string]string{"access_token": "at-123", "token_type": "Bearer"})
+	})
+	mux.HandleFunc("/userinfo", func(wr http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Authorization") != "Bearer at-123" {
+			wr.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(wr).Encode(map[string]interface{}{
+			"sub":                "user-1",
+			"email":              "nick@example.com",
+			"email_verified":     "true",
+			"name":               "Nick",
+			"preferred_username": "nick",
+		})
+	})
+	return srv
+}
+
+func TestProvider_OIDC(t *testing.T) {
+	srv := mockOIDC(t)
+	defer srv.Close()
+
+	p := &Provider{
+		Name:         "mock",
+		ClientID:     "client",
+		ClientSecret: "shh",
+		RedirectURL:  "http://localhost:8080/auth/oauth/mock/callback",
+		Scopes:       []string{"openid", "email"},
+	}
+	ctx := context.Background()
+	if err := p.Discover(ctx, srv.URL); err != nil {
+		t.Fatal("Discover() failed", err)
+	}
+
+	u, err := url.Parse(p.AuthCodeURL("some-state"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Path != "/authorize" || u.Query().Get("state") != "some-state" || u.Query().Get("scope") != "openid email" {
+		t.Errorf("AuthCodeURL() = %s", u)
+	}
+
+	if _, err := p.Exchange(ctx, "bad-code"); err == nil || !strings.Contains(err.Error(), "invalid_grant") {
+		t.Errorf("Exchange() with a bad code got err %v", err)
+	}
+	token, err := p.Exchange(ctx, "good-code")
+	if err != nil {
+		t.Fatal("Exchange() failed", err)
+	}
+
+	id, err := p.Identity(ctx, token)
+	if err != nil {
+		t.Fatal("Identity() failed", err)
+	}
+	want := Identity{Subject: "user-1", Email: "nick@example.com", EmailVerified: true, Name: "Nick", Username: "nick"}
+	if id != want {
+		t.Errorf("Identity() = %+v, want %+v", id, want)
+	}
+
+	if _, err := p.Identity(ctx, "stolen"); err == nil {
+		t.Error("Identity() with a bad token should fail")
+	}
+}
+
+func TestProvider_GitHub(t *testing.T) {
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	mux.HandleFunc("/user", func(wr http.ResponseWriter, req *http.Request) {
+		wr.Write([]byte(`{"id": 583231, "login": "octocat", "name": "The Octocat", "email": "public@example.com"}`))
+	})
+	mux.HandleFunc("/user/emails", func(wr http.ResponseWriter, req *http.Request) {
+		wr.Write([]byte(`[
+			{"email": "old@example.com", "primary": false, "verified": true},
+			{"email": "octocat@example.com", "primary": true, "verified": true}
+		]`))
+	})
+
+	p := GitHub("client", "shh", "")
+	p.UserInfoURL = srv.URL + "/user"
+	p.EmailsURL = srv.URL + "/user/emails"
+	id, err := p.Identity(context.Background(), "at")
+	if err != nil {
+		t.Fatal("Identity() failed", err)
+	}
+	want := Identity{Subject: "583231", Email: "octocat@example.com", EmailVerified: true, Name: "The Octocat", Username: "octocat"}
+	if id != want {
+		t.Errorf("Identity() = %+v, want %+v", id, want)
+	}
+}
@@ -0,0 +1,73 @@
+package showcash
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gofrs/uuid"
+)
+
+const maxReportReason = 500
+
+func (c *Core) apiPostReport(wr http.ResponseWriter, req *http.Request) {
+	u := GetSessionFromContext(req)
+	if u == nil {
+		apiUnauthorizedError.write(wr)
+		return
+	}
+
+	report := Report{}
+	if err := json.NewDecoder(req.Body).Decode(&report); err != nil {
+		log.Println("apiPostReport.Decode() failed", err)
+		apiBadJSONError.write(wr)
+		return
+	}
+
+	report.TargetType = strings.ToLower(report.TargetType)
+	report.Reason = strings.TrimSpace(report.Reason)
+	if err := validateReport(report); err != nil {
+		validationResponse(wr, err)
+		return
+	}
+	if report.TargetID == uuid.Nil || !c.dao.reportTargetExists(report.TargetType, report.TargetID) {
+		apiNotFoundError.write(wr)
+		return
+	}
+
+	report.ReporterID = u.UserID
+	result, err := c.dao.createReport(report)
+	if pgErrIs(err, errNotUnique) {
+		apiConflictError.withCode("already_reported").withMessage("You've already reported this").write(wr)
+		return
+	} else if err != nil {
+		log.Println("apiPostReport().createReport failed", err)
+		apiServerError.write(wr)
+		return
+	}
+
+	hidden, err := c.dao.hideIfReported(result.TargetType, result.TargetID, c.reportThreshold)
+	if err != nil {
+		log.Println("apiPostReport().hideIfReported failed", err)
+	} else if hidden {
+		log.Println("Hid", result.TargetType, result.TargetID, "after too many reports")
+	}
+
+	if err := json.NewEncoder(wr).Encode(result); err != nil {
+		log.Printf("Error Encoding JSON: %s", err)
+	}
+}
+
+func (c *Core) apiGetReports(wr http.ResponseWriter, req *http.Request) {
+	u := GetSessionFromContext(req)
+	if u == nil || !c.dao.isModerator(u.UserID) {
+		apiForbiddenError.withMessage("Moderators only").write(wr)
+		return
+	}
+
+	result := c.dao.getReportSummaries()
+	if err := json.NewEncoder(wr).Encode(result); err != nil {
+		log.Printf("Error Encoding JSON: %s", err)
+	}
+}
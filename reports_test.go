@@ -0,0 +1,53 @@
+package showcash
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gofrs/uuid"
+)
+
+func TestCore_HandlerReports(t *testing.T) {
+	store, srv, nick := newTestServer(t, WithReportThreshold(2))
+	defer srv.Close()
+	kim := newTestUser(t, store, "Kim")
+	lee := newLoggedInClient(t, srv, newTestUser(t, store, "Lee"))
+
+	if got := nick.do(http.MethodGet, "/api/reports", nil, nil); got != http.StatusForbidden {
+		t.Errorf("listing reports as a user = %d, want %d", got, http.StatusForbidden)
+	}
+
+	tests := []struct {
+		name    string
+		client  *apiClient
+		report  Report
+		want    int
+		wantKim int // status of Kim's profile afterwards
+	}{
+		{"unknown target type", nick, Report{TargetType: "tag", TargetID: kim.UserID, Reason: "rude"}, http.StatusBadRequest, http.StatusOK},
+		{"no reason", nick, Report{TargetType: "user", TargetID: kim.UserID, Reason: " "}, http.StatusBadRequest, http.StatusOK},
+		{"nothing there", nick, Report{TargetType: "user", TargetID: uuid.Must(uuid.NewV4()), Reason: "rude"}, http.StatusNotFound, http.StatusOK},
+		{"first report", nick, Report{TargetType: "User", TargetID: kim.UserID, Reason: "rude"}, http.StatusOK, http.StatusOK},
+		{"same reporter again", nick, Report{TargetType: "user", TargetID: kim.UserID, Reason: "still rude"}, http.StatusConflict, http.StatusOK},
+		{"reaches the threshold", lee, Report{TargetType: "user", TargetID: kim.UserID, Reason: "spam"}, http.StatusOK, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.client.do(http.MethodPost, "/api/reports", tt.report, nil); got != tt.want {
+				t.Errorf("reporting = %d, want %d", got, tt.want)
+			}
+			if got := nick.do(http.MethodGet, "/api/profile/Kim", nil, nil); got != tt.wantKim {
+				t.Errorf("Kim's profile = %d, want %d", got, tt.wantKim)
+			}
+		})
+	}
+
+	store.user(nick.user.UserID).moderator = true
+	summaries := []ReportSummary{}
+	if got := nick.do(http.MethodGet, "/api/reports", nil, &summaries); got != http.StatusOK {
+		t.Fatalf("listing reports as a moderator = %d", got)
+	}
+	if len(summaries) != 1 || summaries[0].TargetID != kim.UserID || summaries[0].Reports != 2 || !summaries[0].Hidden {
+		t.Errorf("report summaries = %+v", summaries)
+	}
+}
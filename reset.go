@@ -0,0 +1,98 @@
+package showcash
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// resetPasswordTTL is how long the link in a reset email works for
+const resetPasswordTTL = time.Hour
+
+// forgotResponse is the same whether or not we know the email address so
+// nobody can use it to find accounts
+const forgotResponse = "If that email has an account you'll get a reset link shortly"
+
+func (c *Core) apiPostForgot(wr http.ResponseWriter, req *http.Request) {
+	payload := struct {
+		EmailAddress string `json:"email_address"`
+	}{}
+	if err := json.NewDecoder(req.Body).Decode(&payload); err != nil {
+		log.Println("apiPostForgot.Decode() failed", err)
+		apiBadJSONError.write(wr)
+		return
+	}
+
+	// Mail goes out in the background so the response time doesn't give
+	// away whether the account exists either
+	go func(email string) {
+		user, err := c.dao.getUserByEmail(email)
+		if err != nil {
+			if !errors.Is(err, sql.ErrNoRows) {
+				log.Println("apiPostForgot().getUserByEmail failed", err)
+			}
+			return
+		}
+		if err := c.sendPasswordReset(user); err != nil {
+			log.Println("apiPostForgot().sendPasswordReset failed", err)
+		}
+	}(payload.EmailAddress)
+
+	apiOK.withMessage(forgotResponse).write(wr)
+}
+
+func (c *Core) sendPasswordReset(u User) error {
+	token, err := c.issueToken(u.UserID, tokenResetPassword, u.EmailAddress, resetPasswordTTL)
+	if err != nil {
+		return err
+	}
+	link := fmt.Sprintf("%s/reset?token=%s", c.siteURL, url.QueryEscape(token))
+	return c.mailer.Send(u.EmailAddress, "Reset your Showcash password", fmt.Sprintf(
+		"Hi %s,\n\nSomeone (hopefully you) asked to reset your password. Click the link below to choose a new one:\n\n%s\n\n"+
+			"The link works for %d minutes. If you didn't ask for this you can ignore this email.\n",
+		u.Username, link, int(resetPasswordTTL.Minutes()),
+	))
+}
+
+func (c *Core) apiPostReset(wr http.ResponseWriter, req *http.Request) {
+	payload := struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}{}
+	if err := json.NewDecoder(req.Body).Decode(&payload); err != nil {
+		log.Println("apiPostReset.Decode() failed", err)
+		apiBadJSONError.write(wr)
+		return
+	}
+
+	if err := validatePassword(payload.Password); err != nil {
+		validationResponse(wr, err)
+		return
+	}
+
+	st, err := decodeToken(payload.Token, tokenResetPassword)
+	if err != nil {
+		apiExpiredLinkError.write(wr)
+		return
+	}
+
+	// The link is only used up if the new password sticks. Logs out every
+	// session and API token, including whoever got into the account.
+	err = c.dao.resetPasswordWithToken(hashToken(st.Nonce), st.UserID, payload.Password)
+	if errors.Is(err, sql.ErrNoRows) {
+		apiExpiredLinkError.write(wr)
+		return
+	} else if err != nil {
+		log.Println("apiPostReset().resetPasswordWithToken failed", err)
+		apiServerError.write(wr)
+		return
+	}
+	log.Println("Password reset for", st.UserID)
+	clearUserCookie(wr)
+	apiOK.write(wr)
+}
@@ -0,0 +1,59 @@
+package showcash
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestCore_HandlerPasswordReset(t *testing.T) {
+	mail := &testMailer{}
+	store, srv, nick := newTestServer(t, WithMailer(mail))
+	defer srv.Close()
+	user := nick.user
+
+	// Nobody can tell which emails have accounts
+	forgot := func(email string) (int, apiSimpleResponse) {
+		resp := apiSimpleResponse{}
+		return newAPIClient(t, srv).do(http.MethodPost, "/auth/forgot", map[string]string{"email_address": email}, &resp), resp
+	}
+	knownStatus, known := forgot("nick@example.com")
+	unknownStatus, unknown := forgot("nobody@example.com")
+	if knownStatus != http.StatusOK || knownStatus != unknownStatus || known.Message != unknown.Message || known.Message != forgotResponse {
+		t.Errorf("forgot for a known email = %d %+v, unknown = %d %+v", knownStatus, known, unknownStatus, unknown)
+	}
+	token := mail.token("nick@example.com")
+	if token == "" {
+		t.Fatal("no reset email")
+	}
+	if mail.token("nobody@example.com") != "" {
+		t.Error("an email without an account got a reset link")
+	}
+
+	reset := func(password string) (int, apiSimpleResponse) {
+		resp := apiSimpleResponse{}
+		return newAPIClient(t, srv).do(http.MethodPost, "/auth/reset", map[string]string{"token": token, "password": password}, &resp), resp
+	}
+	if got, resp := reset("short"); got != http.StatusBadRequest || resp.Code != "invalid_fields" {
+		t.Errorf("resetting to a weak password = %d %+v", got, resp)
+	}
+	if got, resp := reset("battery staple"); got != http.StatusOK {
+		t.Fatalf("reset = %d %+v", got, resp)
+	}
+	if got, resp := reset("another one"); got != http.StatusBadRequest || resp.Code != "expired" {
+		t.Errorf("using the link twice = %d %+v", got, resp)
+	}
+
+	// Every session from before the reset is logged out
+	if epoch, err := store.getSessionEpoch(user.UserID); err != nil || epoch != 1 {
+		t.Errorf("session epoch after reset = %d %v, want 1", epoch, err)
+	}
+	if got := nick.do(http.MethodGet, "/api/profile", nil, nil); got != http.StatusUnauthorized {
+		t.Errorf("old session after reset = %d, want %d", got, http.StatusUnauthorized)
+	}
+	if got := nick.do(http.MethodPost, "/auth/login", map[string]string{"username": "Nick", "password": testPassword}, nil); got != http.StatusUnauthorized {
+		t.Errorf("login with the old password = %d, want %d", got, http.StatusUnauthorized)
+	}
+	if got := nick.do(http.MethodPost, "/auth/login", map[string]string{"username": "Nick", "password": "battery staple"}, nil); got != http.StatusOK {
+		t.Errorf("login with the new password = %d", got)
+	}
+}
@@ -0,0 +1,82 @@
+package showcash
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// ServerConfig is how Start() listens
+type ServerConfig struct {
+	Addr            string
+	ReadTimeout     time.Duration
+	WriteTimeout    time.Duration // uploads come in as base64 JSON, so be generous
+	IdleTimeout     time.Duration
+	ShutdownTimeout time.Duration // how long in-flight requests get to finish
+	TLSCertFile     string        // TLS is on when both files are set
+	TLSKeyFile      string
+}
+
+// DefaultServerConfig listens on :8080 without TLS
+func DefaultServerConfig() ServerConfig {
+	return ServerConfig{
+		Addr:            ":8080",
+		ReadTimeout:     30 * time.Second,
+		WriteTimeout:    60 * time.Second,
+		IdleTimeout:     120 * time.Second,
+		ShutdownTimeout: 30 * time.Second,
+	}
+}
+
+// serve runs srv until SIGINT or SIGTERM, then stops taking new requests
+// and gives the ones in flight, and any account jobs, until the shutdown
+// timeout to finish
+func (c *Core) serve(srv *http.Server, sc ServerConfig) error {
+	errs := make(chan error, 1)
+	go func() {
+		if sc.TLSCertFile != "" && sc.TLSKeyFile != "" {
+			errs <- srv.ListenAndServeTLS(sc.TLSCertFile, sc.TLSKeyFile)
+		} else {
+			errs <- srv.ListenAndServe()
+		}
+	}()
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(stop)
+
+	select {
+	case err := <-errs:
+		return err
+	case sig := <-stop:
+		log.Println("Got", sig, "- shutting down")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), sc.ShutdownTimeout)
+	defer cancel()
+	err := srv.Shutdown(ctx)
+	if err != nil {
+		log.Println("Shutdown didn't finish cleanly", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		c.jobs.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		log.Println("Gave up waiting on account jobs, they'll resume on restart")
+	}
+
+	if listenErr := <-errs; !errors.Is(listenErr, http.ErrServerClosed) {
+		return listenErr
+	}
+	return err
+}
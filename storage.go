@@ -0,0 +1,86 @@
+package showcash
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+const (
+	s3Bucket       = "showcash-uploads"
+	s3ImageBaseURI = "https://images.showcash.io/"
+	localBaseURI   = "http://localhost:8080/static/"
+	localStatic    = "../../static/"
+)
+
+// imageUpload is how the frontend sends us images
+type imageUpload struct {
+	File     string `json:"file,omitempty"` // base64
+	Filename string `json:"filename,omitempty"`
+}
+
+// storeImage puts an image in S3 or the local static folder and returns
+// the URI it can be fetched from
+func (c *Core) storeImage(fileName string, data []byte) (string, error) {
+	fileName = filepath.Base(fileName)
+	if c.useS3 {
+		uploader := s3manager.NewUploader(awsSession)
+		resp, err := uploader.Upload(&s3manager.UploadInput{
+			Bucket:      aws.String(s3Bucket),
+			Key:         aws.String(fileName),
+			Body:        bytes.NewReader(data),
+			ContentType: aws.String(http.DetectContentType(data)),
+		})
+		if err != nil {
+			return "", err
+		}
+		log.Println("Uploaded to:", resp.Location)
+		return s3ImageBaseURI + fileName, nil
+	}
+
+	// Put it local
+	f, err := os.Create(localStatic + fileName)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	if _, err := f.Write(data); err != nil {
+		return "", err
+	}
+	if err := f.Sync(); err != nil {
+		return "", err
+	}
+	return localBaseURI + fileName, nil
+}
+
+// removeImage deletes an image we stored with storeImage()
+// Anything we didn't store is left alone.
+func (c *Core) removeImage(uri string) error {
+	if c.useS3 {
+		if !strings.HasPrefix(uri, s3ImageBaseURI) {
+			return nil
+		}
+		_, err := s3.New(awsSession).DeleteObject(&s3.DeleteObjectInput{
+			Bucket: aws.String(s3Bucket),
+			Key:    aws.String(filepath.Base(strings.TrimPrefix(uri, s3ImageBaseURI))),
+		})
+		return err
+	}
+
+	if !strings.HasPrefix(uri, localBaseURI) {
+		return nil
+	}
+	err := os.Remove(localStatic + filepath.Base(strings.TrimPrefix(uri, localBaseURI)))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
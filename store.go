@@ -0,0 +1,124 @@
+package showcash
+
+import (
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+// Store is everything Core needs to keep. DAO is the postgres version and
+// MemStore keeps it all in memory for tests and hacking on the frontend.
+type Store interface {
+	IsConnected() bool
+	Close() error
+
+	// Posts
+	createPost(userID uuid.UUID, p Post) (Post, error)
+	claimPost(userID uuid.UUID, postID uuid.UUID) error
+	updatePost(userID uuid.UUID, p Post) (Post, error)
+	getPost(postID uuid.UUID) (Post, error)
+	deletePost(postID uuid.UUID)
+	increaseView(postID uuid.UUID, uniqueValue string)
+	getLatestPosts() []Post
+	getUsersLatestPosts(userID uuid.UUID) []Post
+	getMostViewedPosts() []Post
+
+	// Comments
+	getCommentsForPostID(postID uuid.UUID) []Comment
+	createComment(userID uuid.UUID, postID uuid.UUID, c Comment) (Comment, error)
+
+	// Users and profiles
+	getUserProfileByID(userID uuid.UUID) (UserProfile, error)
+	getUserProfileByHandle(handle string) (UserProfile, error)
+	getUserIDByHandle(handle string) (uuid.UUID, error)
+	getUserByUsernameAndPassword(username, password string) (User, error)
+	getLoginUser(userID uuid.UUID) (User, error)
+	getUserByEmailAndPassword(email, password string) (User, error)
+	createUser(u User) (User, error)
+	updateUser(u User) (User, error)
+	setProfileURI(userID uuid.UUID, uri string) (string, error)
+	changeUsername(userID uuid.UUID, username string, cooldown, reservation time.Duration) error
+	getCurrentUsername(oldHandle string) (string, error)
+	isUsernameReserved(username string) bool
+
+	// Tags
+	createTags(tags []string) ([]string, error)
+	setPostTags(postID uuid.UUID, tags []string)
+	removePostTags(postID uuid.UUID, tags []string)
+	getMostPopularTags() []string
+	getPostsByTags(tags []string) []Post
+
+	// Moderation
+	createReport(r Report) (Report, error)
+	reportTargetExists(targetType string, targetID uuid.UUID) bool
+	hideIfReported(targetType string, targetID uuid.UUID, threshold int) (bool, error)
+	getReportSummaries() []ReportSummary
+	isModerator(userID uuid.UUID) bool
+	getFilterRules() ([]FilterRule, error)
+
+	// Follows and the feed
+	hydrateFollows(up *UserProfile)
+	follow(followerID, followeeID uuid.UUID) error
+	unfollow(followerID, followeeID uuid.UUID) error
+	getFollowers(userID uuid.UUID, limit, offset int) []UserProfile
+	getFollowing(userID uuid.UUID, limit, offset int) []UserProfile
+	hasFollows(userID uuid.UUID) bool
+	getFeed(userID uuid.UUID, cursor *feedCursor, limit int) []Post
+	followTags(userID uuid.UUID, tags []string) error
+	unfollowTags(userID uuid.UUID, tags []string) error
+	getInterests(userID uuid.UUID) []string
+	setInterests(userID uuid.UUID, interests []string) ([]string, error)
+
+	// Emailed tokens, passwords and sessions
+	createUserToken(t UserToken) error
+	consumeUserToken(tokenHash, purpose string) (UserToken, error)
+	setEmailVerified(userID uuid.UUID, email string) error
+	isEmailVerified(userID uuid.UUID) bool
+	getEmailAddress(userID uuid.UUID) (string, error)
+	getSessionEpoch(userID uuid.UUID) (int, error)
+	getUserByEmail(email string) (User, error)
+	resetPassword(userID uuid.UUID, password string) error
+	resetPasswordWithToken(tokenHash string, userID uuid.UUID, password string) error
+	checkPassword(userID uuid.UUID, password string) bool
+	changeEmail(userID uuid.UUID, email string) error
+
+	// Exporting and deleting accounts
+	getAccountExport(userID uuid.UUID) (AccountExport, error)
+	deleteAccount(userID uuid.UUID) ([]string, error)
+	createAccountJob(userID uuid.UUID, kind string) (AccountJob, error)
+	getAccountJob(jobID uuid.UUID) (AccountJob, error)
+	getUnfinishedAccountJobs() []AccountJob
+	setAccountJobStatus(jobID uuid.UUID, status string, jobErr error)
+
+	// Login throttling
+	getUserIDByLogin(login string) (uuid.UUID, error)
+	recordLoginAttempt(a LoginAttempt)
+	takeLoginAttempt(key string, since time.Time) (int, time.Time, error)
+	refundLoginAttempt(key string)
+	clearLoginFailures(key string)
+	pruneLoginAttempts(before, idleSince time.Time) error
+
+	// Two factor
+	getTOTP(userID uuid.UUID) (string, bool, error)
+	setTOTPSecret(userID uuid.UUID, secret string) (bool, error)
+	useTOTPStep(userID uuid.UUID, step int64) bool
+	enableTOTP(userID uuid.UUID, recoveryHashes []string) error
+	disableTOTP(userID uuid.UUID) error
+	useRecoveryCode(userID uuid.UUID, codeHash string) bool
+
+	// OAuth logins
+	getOAuthIdentity(provider, subject string) (uuid.UUID, error)
+	linkOAuthIdentity(provider, subject string, userID uuid.UUID, email string) error
+	createOAuthUser(u User, provider, subject, email string) (User, error)
+
+	// API tokens
+	createAPIToken(t APIToken, tokenHash string) (APIToken, error)
+	getAPITokens(userID uuid.UUID) []APIToken
+	useAPIToken(tokenHash string) (APIToken, User, error)
+	revokeAPIToken(userID, tokenID uuid.UUID) error
+}
+
+var (
+	_ Store = (*DAO)(nil)
+	_ Store = (*MemStore)(nil)
+)
@@ -23,6 +23,10 @@ func Test_getTags(t *testing.T) {
 			name: "Porn URL check",
 			args: args{tags: []string{"pinkspornlist.com", "sexy"}},
 			want: []string{"sexy"},
+		}, {
+			name: "Scunthorpe edition",
+			args: args{tags: []string{"transport", "analysis", "scunthorpe", "anal"}},
+			want: []string{"transport", "analysis", "scunthorpe"},
 		},
 	}
 	for _, tt := range tests {
@@ -33,3 +37,34 @@ func Test_getTags(t *testing.T) {
 		})
 	}
 }
+
+func Test_isAllowed(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want bool
+	}{
+		{name: "Plain", text: "a lovely desk setup", want: true},
+		{name: "Leetspeak", text: "n1gg3r", want: false},
+		{name: "Leetspeak symbols", text: "n!gger", want: false},
+		{name: "Numbers left alone", text: "4 x 3 = 12", want: true},
+		{name: "Full width", text: "ｃｕｎｔ", want: false},
+		{name: "Cyrillic confusables", text: "сunt", want: false},
+		{name: "Accents", text: "cúnt", want: false},
+		{name: "Zero width joiners", text: "cu\u200dn\u200bt", want: false},
+		{name: "Soft hyphen", text: "nig\u00adger", want: false},
+		{name: "Spacing", text: "you c u n t", want: false},
+		{name: "Dotted spacing", text: "c.u.n.t", want: false},
+		{name: "Spacing with leetspeak", text: "n 1 g g 3 r", want: false},
+		{name: "Short spaced words", text: "a b testing", want: true},
+		{name: "Full width domain", text: "ｐｉｎｋｓｐｏｒｎｌｉｓｔ.ｃｏｍ", want: false},
+		{name: "Scunthorpe", text: "Scunthorpe public transport analysis", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isAllowed(tt.text); got != tt.want {
+				t.Errorf("isAllowed(%q) = %v, want %v", tt.text, got, tt.want)
+			}
+		})
+	}
+}
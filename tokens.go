@@ -0,0 +1,99 @@
+package showcash
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/gorilla/securecookie"
+)
+
+// Purposes for single use tokens we email out
+const (
+	tokenVerifyEmail   = "verify_email"
+	tokenResetPassword = "reset_password"
+	tokenChangeEmail   = "change_email"
+)
+
+var errBadToken = errors.New("token is invalid, expired or already used")
+
+// tokenCodec signs the tokens we email out - the nonce inside is what we
+// keep (hashed) in the database so each token can only be used once
+var tokenCodec = securecookie.New(hashKey, nil).MaxAge(int((7 * 24 * time.Hour).Seconds()))
+
+type signedToken struct {
+	UserID  uuid.UUID
+	Purpose string
+	Nonce   string
+}
+
+// UserToken is a single use token as stored in the database
+type UserToken struct {
+	TokenHash    string    `json:"token_hash"`
+	UserID       uuid.UUID `json:"user_id"`
+	Purpose      string    `json:"purpose"`
+	EmailAddress string    `json:"email_address"`
+	ExpiresAt    time.Time `json:"expires_at"`
+}
+
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashToken(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// issueToken stores a new single use token for purpose and returns the
+// signed version to send to the user
+func (c *Core) issueToken(userID uuid.UUID, purpose, email string, ttl time.Duration) (string, error) {
+	nonce, err := randomString(32)
+	if err != nil {
+		return "", err
+	}
+	if err := c.dao.createUserToken(UserToken{
+		TokenHash:    hashToken(nonce),
+		UserID:       userID,
+		Purpose:      purpose,
+		EmailAddress: email,
+		ExpiresAt:    time.Now().Add(ttl),
+	}); err != nil {
+		return "", err
+	}
+	return tokenCodec.Encode(purpose, signedToken{
+		UserID:  userID,
+		Purpose: purpose,
+		Nonce:   nonce,
+	})
+}
+
+// decodeToken checks the signature on a token without using it up
+func decodeToken(token, purpose string) (signedToken, error) {
+	st := signedToken{}
+	if err := tokenCodec.Decode(purpose, token, &st); err != nil || st.Purpose != purpose {
+		return signedToken{}, errBadToken
+	}
+	return st, nil
+}
+
+// redeemToken checks the signature on a token and uses it up
+func (c *Core) redeemToken(token, purpose string) (UserToken, error) {
+	st, err := decodeToken(token, purpose)
+	if err != nil {
+		return UserToken{}, err
+	}
+	ut, err := c.dao.consumeUserToken(hashToken(st.Nonce), purpose)
+	if err != nil || ut.UserID != st.UserID {
+		return UserToken{}, errBadToken
+	}
+	return ut, nil
+}
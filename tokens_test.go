@@ -0,0 +1,53 @@
+package showcash
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCore_redeemToken(t *testing.T) {
+	store := NewMemStore()
+	c := New(store)
+	user := newTestUser(t, store, "Nick")
+
+	tests := []struct {
+		name    string
+		issue   string // purpose, empty for a made up token
+		ttl     time.Duration
+		redeem  string
+		uses    int // times it's been redeemed already
+		wantErr error
+	}{
+		{"good", tokenVerifyEmail, time.Hour, tokenVerifyEmail, 0, nil},
+		{"reset", tokenResetPassword, time.Hour, tokenResetPassword, 0, nil},
+		{"reused", tokenVerifyEmail, time.Hour, tokenVerifyEmail, 1, errBadToken},
+		{"expired", tokenVerifyEmail, -time.Minute, tokenVerifyEmail, 0, errBadToken},
+		{"wrong purpose", tokenVerifyEmail, time.Hour, tokenResetPassword, 0, errBadToken},
+		{"change email isn't a verify", tokenChangeEmail, time.Hour, tokenVerifyEmail, 0, errBadToken},
+		{"made up", "", time.Hour, tokenVerifyEmail, 0, errBadToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := "not-a-token"
+			if tt.issue != "" {
+				var err error
+				if token, err = c.issueToken(user.UserID, tt.issue, "nick@example.com", tt.ttl); err != nil {
+					t.Fatal("issueToken() failed", err)
+				}
+			}
+			for i := 0; i < tt.uses; i++ {
+				if _, err := c.redeemToken(token, tt.redeem); err != nil {
+					t.Fatal("first redeemToken() failed", err)
+				}
+			}
+
+			ut, err := c.redeemToken(token, tt.redeem)
+			if err != tt.wantErr {
+				t.Fatalf("redeemToken() err = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && (ut.UserID != user.UserID || ut.Purpose != tt.redeem || ut.EmailAddress != "nick@example.com") {
+				t.Errorf("redeemToken() = %+v", ut)
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package showcash
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_hotp(t *testing.T) {
+	// RFC 4226 appendix D
+	key := []byte("12345678901234567890")
+	want := []string{"755224", "287082", "359152", "969429", "338314", "254676", "287922", "162583", "399871", "520489"}
+	for i, w := range want {
+		if got := hotp(key, int64(i)); got != w {
+			t.Errorf("hotp(%d) = %s, want %s", i, got, w)
+		}
+	}
+}
+
+func Test_totpCheck(t *testing.T) {
+	secret := totpEncoding.EncodeToString([]byte("12345678901234567890"))
+	now := time.Unix(59, 0) // RFC 6238 appendix B has 94287082, the last 6 digits are ours
+	tests := []struct {
+		name   string
+		code   string
+		at     time.Time
+		wantOK bool
+	}{
+		{"rfc vector", "287082", now, true},
+		{"with spaces", " 287 082 ", now, true},
+		{"a step late", "287082", now.Add(totpPeriod), true},
+		{"too late", "287082", now.Add(3 * totpPeriod), false},
+		{"wrong code", "123456", now, false},
+		{"too short", "28708", now, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := totpCheck(secret, tt.code, tt.at)
+			if ok != tt.wantOK {
+				t.Fatalf("totpCheck() ok = %v, want %v", ok, tt.wantOK)
+			}
+			if ok && step != totpStep(now) {
+				t.Errorf("totpCheck() step = %d, want %d", step, totpStep(now))
+			}
+		})
+	}
+}
+
+func Test_totpURI(t *testing.T) {
+	got := totpURI("JBSWY3DPEHPK3PXP", "nick")
+	if !strings.HasPrefix(got, "otpauth://totp/Showcash:nick?") || !strings.Contains(got, "secret=JBSWY3DPEHPK3PXP") {
+		t.Errorf("totpURI() = %s", got)
+	}
+}
+
+func Test_newRecoveryCodes(t *testing.T) {
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != recoveryCodeCount || len(hashes) != recoveryCodeCount {
+		t.Fatalf("got %d codes and %d hashes", len(codes), len(hashes))
+	}
+	seen := map[string]bool{}
+	for i, code := range codes {
+		if len(code) != 11 || code[5] != '-' {
+			t.Errorf("code %q isn't formatted like abcde-fghij", code)
+		}
+		if seen[code] {
+			t.Errorf("code %q repeated", code)
+		}
+		seen[code] = true
+		// People retype them however they like
+		typed := strings.ToUpper(strings.Replace(code, "-", " ", 1))
+		if hashRecoveryCode(typed) != hashes[i] {
+			t.Errorf("hashRecoveryCode(%q) doesn't match %q", typed, code)
+		}
+	}
+}
+
+func TestCore_HandlerTwoFactorThrottle(t *testing.T) {
+	store, srv, nick := newTestServer(t)
+	defer srv.Close()
+	user := nick.user
+	if _, err := store.setTOTPSecret(user.UserID, totpEncoding.EncodeToString([]byte("12345678901234567890"))); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.enableTOTP(user.UserID, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// Someone holding the session can't guess codes any faster than at
+	// the login
+	wrong := map[string]string{"code": "000000", "password": testPassword}
+	for i := 0; i < loginFreeAttempts; i++ {
+		if got := nick.do(http.MethodPost, "/api/profile/2fa/recovery", wrong, nil); got != http.StatusForbidden {
+			t.Fatalf("wrong code %d = %d, want %d", i, got, http.StatusForbidden)
+		}
+	}
+	if got := nick.do(http.MethodPost, "/api/profile/2fa/recovery", wrong, nil); got != http.StatusTooManyRequests {
+		t.Errorf("guessing past the free attempts = %d, want %d", got, http.StatusTooManyRequests)
+	}
+	if got := nick.do(http.MethodDelete, "/api/profile/2fa", wrong, nil); got != http.StatusTooManyRequests {
+		t.Errorf("turning 2FA off while throttled = %d, want %d", got, http.StatusTooManyRequests)
+	}
+	if got := newAPIClient(t, srv).do(http.MethodPost, "/auth/login", map[string]string{"username": "Nick", "password": testPassword}, nil); got != http.StatusTooManyRequests {
+		t.Errorf("logging in while throttled = %d, want %d", got, http.StatusTooManyRequests)
+	}
+
+	failures := 0
+	for _, a := range store.loginAttempts {
+		if a.Outcome == loginBadCreds && a.UserID != nil && *a.UserID == user.UserID {
+			failures++
+		}
+	}
+	if failures != loginFreeAttempts {
+		t.Errorf("recorded %d bad codes, want %d", failures, loginFreeAttempts)
+	}
+}
@@ -0,0 +1,331 @@
+package showcash
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/gorilla/securecookie"
+)
+
+const (
+	recoveryCodeCount = 10
+	// twoFactorLoginTTL is how long someone has to enter their code after
+	// getting their password right
+	twoFactorLoginTTL = 5 * time.Minute
+)
+
+// twoFactorCodec signs the half finished login handed back by apiPostLogin
+var twoFactorCodec = securecookie.New(hashKey, blockKey).MaxAge(int(twoFactorLoginTTL.Seconds()))
+
+type pendingLogin struct {
+	UserID uuid.UUID
+	Login  string // as throttled in the first step
+}
+
+// newRecoveryCodes makes a set of codes like "abcde-fghij" and their hashes
+func newRecoveryCodes() ([]string, []string, error) {
+	const alphabet = "abcdefghijklmnopqrstuvwxyz234567"
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	b := make([]byte, 10)
+	for i := range codes {
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		for j := range b {
+			b[j] = alphabet[int(b[j])%len(alphabet)]
+		}
+		codes[i] = string(b[:5]) + "-" + string(b[5:])
+		hashes[i] = hashRecoveryCode(codes[i])
+	}
+	return codes, hashes, nil
+}
+
+// hashRecoveryCode ignores the case and punctuation people type them with
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	code = strings.NewReplacer("-", "", " ", "").Replace(code)
+	return hashToken(code)
+}
+
+// checkSecondFactor accepts either a current TOTP code or an unused
+// recovery code, using it up either way
+func (c *Core) checkSecondFactor(userID uuid.UUID, code string) bool {
+	secret, enabled, err := c.dao.getTOTP(userID)
+	if err != nil || !enabled {
+		return false
+	}
+	if step, ok := totpCheck(secret, code, time.Now()); ok {
+		return c.dao.useTOTPStep(userID, step)
+	}
+	return c.dao.useRecoveryCode(userID, hashRecoveryCode(code))
+}
+
+// checkCodeThrottled is for checking a code, or password, from someone
+// already logged in. They'd otherwise get to guess six digits as fast as
+// they like, so it shares the login throttle and failures count against
+// it. It writes the throttled response itself, returning ok false, and
+// otherwise returns whether check passed.
+func (c *Core) checkCodeThrottled(wr http.ResponseWriter, req *http.Request, u *User, check func() bool) (passed, ok bool) {
+	account, ip, login := userLoginKey(u.UserID), c.clientIP(req), strings.ToLower(u.Username)
+	if wait := c.loginThrottle(account, ip); wait > 0 {
+		c.recordLogin(req, login, u.UserID, loginThrottled)
+		throttledResponse(wr, wait)
+		return false, false
+	}
+	if !check() {
+		c.recordLogin(req, login, u.UserID, loginBadCreds)
+		return false, true
+	}
+	c.refundLogin(account, ip)
+	return true, true
+}
+
+// startTwoFactorLogin hands back a token to swap for a session with a code
+func (c *Core) startTwoFactorLogin(wr http.ResponseWriter, req *http.Request, login string, user User) {
+	c.recordLogin(req, login, user.UserID, loginTwoFactor)
+	token, err := twoFactorCodec.Encode("showcash-2fa", pendingLogin{
+		UserID: user.UserID,
+		Login:  login,
+	})
+	if err != nil {
+		log.Println("startTwoFactorLogin().Encode failed", err)
+		apiServerError.write(wr)
+		return
+	}
+	if err := json.NewEncoder(wr).Encode(struct {
+		TwoFactorRequired bool   `json:"two_factor_required"`
+		TwoFactorToken    string `json:"two_factor_token"`
+	}{
+		TwoFactorRequired: true,
+		TwoFactorToken:    token,
+	}); err != nil {
+		log.Printf("Error Encoding JSON: %s", err)
+	}
+}
+
+// apiPostLoginTwoFactor is the second step of logging in with 2FA on
+func (c *Core) apiPostLoginTwoFactor(wr http.ResponseWriter, req *http.Request) {
+	payload := struct {
+		Token string `json:"two_factor_token"`
+		Code  string `json:"code"`
+	}{}
+	if err := json.NewDecoder(req.Body).Decode(&payload); err != nil {
+		log.Println("apiPostLoginTwoFactor.Decode() failed", err)
+		apiBadJSONError.write(wr)
+		return
+	}
+
+	// Provider logins hand the token over in a cookie instead
+	if cookie, err := req.Cookie("showcash-2fa"); err == nil && payload.Token == "" {
+		payload.Token = cookie.Value
+	}
+	pending := pendingLogin{}
+	if err := twoFactorCodec.Decode("showcash-2fa", payload.Token, &pending); err != nil {
+		apiUnauthorizedError.withCode("expired").withMessage("That login has expired, start again").write(wr)
+		return
+	}
+
+	// Six digits don't take long to guess so they share the password's
+	// throttle
+	account, ip := userLoginKey(pending.UserID), c.clientIP(req)
+	if wait := c.loginThrottle(account, ip); wait > 0 {
+		c.recordLogin(req, pending.Login, pending.UserID, loginThrottled)
+		throttledResponse(wr, wait)
+		return
+	}
+	if !c.checkSecondFactor(pending.UserID, payload.Code) {
+		c.recordLogin(req, pending.Login, pending.UserID, loginBadCreds)
+		apiBadCredsError.write(wr)
+		return
+	}
+	c.loginPassed(account, ip)
+
+	user, err := c.dao.getLoginUser(pending.UserID)
+	if err != nil {
+		log.Println("apiPostLoginTwoFactor().getLoginUser failed", err)
+		apiBadCredsError.write(wr)
+		return
+	}
+	http.SetCookie(wr, &http.Cookie{Name: "showcash-2fa", Path: "/auth/login/2fa", MaxAge: -1})
+	c.completeLogin(wr, req, pending.Login, user)
+}
+
+// apiPostTwoFactor starts enrolment, the secret does nothing until it's
+// confirmed with apiPostTwoFactorConfirm
+func (c *Core) apiPostTwoFactor(wr http.ResponseWriter, req *http.Request) {
+	u := GetSessionFromContext(req)
+	if u == nil {
+		apiUnauthorizedError.write(wr)
+		return
+	}
+
+	secret, err := newTOTPSecret()
+	if err != nil {
+		log.Println("apiPostTwoFactor().newTOTPSecret failed", err)
+		apiServerError.write(wr)
+		return
+	}
+	started, err := c.dao.setTOTPSecret(u.UserID, secret)
+	if err != nil {
+		log.Println("apiPostTwoFactor().setTOTPSecret failed", err)
+		apiServerError.write(wr)
+		return
+	}
+	if !started {
+		apiConflictError.withCode("two_factor_on").withMessage("Two factor is already on").write(wr)
+		return
+	}
+
+	if err := json.NewEncoder(wr).Encode(struct {
+		Secret     string `json:"secret"`
+		OTPAuthURI string `json:"otpauth_uri"`
+	}{
+		Secret:     secret,
+		OTPAuthURI: totpURI(secret, u.Username),
+	}); err != nil {
+		log.Printf("Error Encoding JSON: %s", err)
+	}
+}
+
+// apiPostTwoFactorConfirm turns 2FA on once the user proves their app has
+// the secret, and hands out recovery codes
+func (c *Core) apiPostTwoFactorConfirm(wr http.ResponseWriter, req *http.Request) {
+	u := GetSessionFromContext(req)
+	if u == nil {
+		apiUnauthorizedError.write(wr)
+		return
+	}
+
+	payload := struct {
+		Code string `json:"code"`
+	}{}
+	if err := json.NewDecoder(req.Body).Decode(&payload); err != nil {
+		log.Println("apiPostTwoFactorConfirm.Decode() failed", err)
+		apiBadJSONError.write(wr)
+		return
+	}
+
+	secret, enabled, err := c.dao.getTOTP(u.UserID)
+	if err != nil {
+		log.Println("apiPostTwoFactorConfirm().getTOTP failed", err)
+		apiServerError.write(wr)
+		return
+	}
+	if enabled {
+		apiConflictError.withCode("two_factor_on").withMessage("Two factor is already on").write(wr)
+		return
+	}
+	if secret == "" {
+		apiBadRequestError.withMessage("Start setting up two factor first").write(wr)
+		return
+	}
+	passed, ok := c.checkCodeThrottled(wr, req, u, func() bool {
+		step, ok := totpCheck(secret, payload.Code, time.Now())
+		return ok && c.dao.useTOTPStep(u.UserID, step)
+	})
+	if !ok {
+		return
+	}
+	if !passed {
+		apiBadRequestError.withCode("bad_code").withMessage("That code didn't work, check your phone's clock").write(wr)
+		return
+	}
+
+	c.issueRecoveryCodes(wr, u.UserID)
+}
+
+// apiPostRecoveryCodes replaces the recovery codes, for when they've run
+// low or been lost
+func (c *Core) apiPostRecoveryCodes(wr http.ResponseWriter, req *http.Request) {
+	u := GetSessionFromContext(req)
+	if u == nil {
+		apiUnauthorizedError.write(wr)
+		return
+	}
+
+	payload := struct {
+		Code string `json:"code"`
+	}{}
+	if err := json.NewDecoder(req.Body).Decode(&payload); err != nil {
+		log.Println("apiPostRecoveryCodes.Decode() failed", err)
+		apiBadJSONError.write(wr)
+		return
+	}
+	passed, ok := c.checkCodeThrottled(wr, req, u, func() bool {
+		return c.checkSecondFactor(u.UserID, payload.Code)
+	})
+	if !ok {
+		return
+	}
+	if !passed {
+		apiWrongPasswordError.write(wr)
+		return
+	}
+
+	c.issueRecoveryCodes(wr, u.UserID)
+}
+
+func (c *Core) issueRecoveryCodes(wr http.ResponseWriter, userID uuid.UUID) {
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		log.Println("issueRecoveryCodes().newRecoveryCodes failed", err)
+		apiServerError.write(wr)
+		return
+	}
+	if err := c.dao.enableTOTP(userID, hashes); err != nil {
+		log.Println("issueRecoveryCodes().enableTOTP failed", err)
+		apiServerError.write(wr)
+		return
+	}
+
+	// This is the only time anyone sees them
+	if err := json.NewEncoder(wr).Encode(struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}{
+		RecoveryCodes: codes,
+	}); err != nil {
+		log.Printf("Error Encoding JSON: %s", err)
+	}
+}
+
+// apiDeleteTwoFactor turns 2FA off, which takes the password and a code
+func (c *Core) apiDeleteTwoFactor(wr http.ResponseWriter, req *http.Request) {
+	u := GetSessionFromContext(req)
+	if u == nil {
+		apiUnauthorizedError.write(wr)
+		return
+	}
+
+	payload := struct {
+		Password string `json:"password"`
+		Code     string `json:"code"`
+	}{}
+	if err := json.NewDecoder(req.Body).Decode(&payload); err != nil {
+		log.Println("apiDeleteTwoFactor.Decode() failed", err)
+		apiBadJSONError.write(wr)
+		return
+	}
+	passed, ok := c.checkCodeThrottled(wr, req, u, func() bool {
+		return c.dao.checkPassword(u.UserID, payload.Password) && c.checkSecondFactor(u.UserID, payload.Code)
+	})
+	if !ok {
+		return
+	}
+	if !passed {
+		apiWrongPasswordError.write(wr)
+		return
+	}
+
+	if err := c.dao.disableTOTP(u.UserID); err != nil {
+		log.Println("apiDeleteTwoFactor().disableTOTP failed", err)
+		apiServerError.write(wr)
+		return
+	}
+	apiOK.write(wr)
+}
@@ -5,31 +5,54 @@ import (
 	"time"
 
 	"github.com/gofrs/uuid"
+	"github.com/lib/pq"
 )
 
+// Every error, and the odd response with nothing else to say, comes back
+// as an apiSimpleResponse:
+//
+//	{"code": "invalid_fields", "message": "Some fields need fixing", "errors": [{"field": "username", "message": "..."}]}
+//
+// Clients switch on code, which never changes once it's out. message is
+// for people and errors is only there when fields need fixing. The status
+// says what kind of problem it is: 400 bad input, 401 not logged in (or
+// the wrong password when logging in), 403 not allowed (or the wrong
+// password when confirming something while logged in), 404 not there, 409
+// clashes with something that is, 429 slow down and 500 our fault.
 var (
-	apiServerError       = apiSimpleResponse{Error: "Generic Server Error", statusCode: http.StatusInternalServerError}
-	apiBadRequestError   = apiSimpleResponse{Error: "Bad Request", statusCode: http.StatusBadRequest}
-	apiUnauthorizedError = apiSimpleResponse{Error: "Unauthorized", statusCode: http.StatusUnauthorized}
-	apiNotFoundError     = apiSimpleResponse{Error: "Not Found", statusCode: http.StatusNotFound}
-	apiOK                = apiSimpleResponse{Message: "success", statusCode: http.StatusOK}
+	apiBadRequestError       = apiSimpleResponse{Code: "bad_request", Message: "Bad Request", statusCode: http.StatusBadRequest}
+	apiBadJSONError          = apiSimpleResponse{Code: "bad_json", Message: "The request body isn't valid JSON", statusCode: http.StatusBadRequest}
+	apiInvalidFieldsError    = apiSimpleResponse{Code: "invalid_fields", Message: "Some fields need fixing", statusCode: http.StatusBadRequest}
+	apiUnauthorizedError     = apiSimpleResponse{Code: "unauthorized", Message: "Log in first", statusCode: http.StatusUnauthorized}
+	apiBadCredsError         = apiSimpleResponse{Code: "bad_credentials", Message: "Bad Creds", statusCode: http.StatusUnauthorized}
+	apiForbiddenError        = apiSimpleResponse{Code: "forbidden", Message: "Forbidden", statusCode: http.StatusForbidden}
+	apiNotFoundError         = apiSimpleResponse{Code: "not_found", Message: "Not Found", statusCode: http.StatusNotFound}
+	apiMethodNotAllowedError = apiSimpleResponse{Code: "method_not_allowed", Message: "Method Not Allowed", statusCode: http.StatusMethodNotAllowed}
+	apiConflictError         = apiSimpleResponse{Code: "conflict", Message: "Conflict", statusCode: http.StatusConflict}
+	apiTooManyRequestsError  = apiSimpleResponse{Code: "too_many_requests", Message: "Too many requests, try again later", statusCode: http.StatusTooManyRequests}
+	apiServerError           = apiSimpleResponse{Code: "server_error", Message: "Generic Server Error", statusCode: http.StatusInternalServerError}
+	apiWrongPasswordError    = apiSimpleResponse{Code: "bad_credentials", Message: "Bad Creds", statusCode: http.StatusForbidden}
+	apiAccountExistsError    = apiSimpleResponse{Code: "account_exists", Message: "Username or email exists... do you have an account?", statusCode: http.StatusConflict}
+	apiExpiredLinkError      = apiSimpleResponse{Code: "expired", Message: "That link is invalid or has expired", statusCode: http.StatusBadRequest}
+	apiOK                    = apiSimpleResponse{Code: "ok", Message: "success", statusCode: http.StatusOK}
 )
 
 type apiSimpleResponse struct {
-	Error      string   `json:"error,omitempty"`
-	Message    string   `json:"message,omitempty"`
-	Messages   []string `json:"messages,omitempty"`
+	Code       string       `json:"code"`
+	Message    string       `json:"message,omitempty"`
+	Errors     []FieldError `json:"errors,omitempty"`
 	statusCode int
 }
 
 // Item is the dope things
 type Item struct {
-	ID          int    `json:"id"`
-	Title       string `json:"title"`
-	Description string `json:"description"`
-	Link        string `json:"link"`
-	Left        int    `json:"left"`
-	Top         int    `json:"top"`
+	ID            int    `json:"id"`
+	Title         string `json:"title"`
+	Description   string `json:"description"`
+	Link          string `json:"link"`
+	CanonicalLink string `json:"canonical_link"`
+	Left          int    `json:"left"`
+	Top           int    `json:"top"`
 }
 
 // Post is the type used for wrapping cool shit
@@ -50,41 +73,128 @@ type Comment struct {
 	Comment  string    `json:"comment,omitempty"`
 	Username string    `json:"username,omitempty"`
 	UserID   uuid.UUID `json:"user_id,omitempty"`
+	PostID   uuid.UUID `json:"post_id,omitempty"`
 	// Points   int       `json:"points"`    // How many points this comment has
 	// HasVoted int       `json:"has_voted"` // If the user voted it up or down -1 | 0 | 1
 }
 
 // User is a showcash user
 type User struct {
-	UserID       uuid.UUID `json:"user_id,omitempty"`
-	Username     string    `json:"username,omitempty"`
-	RealName     string    `json:"realname,omitempty"`
-	Location     string    `json:"location,omitempty"`
-	ProfileURI   string    `json:"profile_uri,omitempty"`
-	Bio          string    `json:"bio,omitempty"`
-	Social1      string    `json:"social_1,omitempty"`
-	Social2      string    `json:"social_2,omitempty"`
-	Social3      string    `json:"social_3,omitempty"`
-	EmailAddress string    `json:"email_address,omitempty"`
-	Password     string    `json:"password,omitempty"`
-	ShadowBanned bool      `json:"shadow_banned,omitempty"`
-	CreatedAt    time.Time `json:"created_at,omitempty"`
+	UserID        uuid.UUID `json:"user_id,omitempty"`
+	Username      string    `json:"username,omitempty"`
+	RealName      string    `json:"realname,omitempty"`
+	Location      string    `json:"location,omitempty"`
+	ProfileURI    string    `json:"profile_uri,omitempty"`
+	Bio           string    `json:"bio,omitempty"`
+	Social1       string    `json:"social_1,omitempty"`
+	Social2       string    `json:"social_2,omitempty"`
+	Social3       string    `json:"social_3,omitempty"`
+	Social1URL    string    `json:"social_1_url,omitempty"`
+	Social2URL    string    `json:"social_2_url,omitempty"`
+	Social3URL    string    `json:"social_3_url,omitempty"`
+	EmailAddress  string    `json:"email_address,omitempty"`
+	Password      string    `json:"password,omitempty"`
+	ShadowBanned  bool      `json:"shadow_banned,omitempty"`
+	EmailVerified bool      `json:"email_verified,omitempty"`
+	TOTPEnabled   bool      `json:"totp_enabled,omitempty"`
+	SessionEpoch  int       `json:"-"` // bumped to log out every session
+	CreatedAt     time.Time `json:"created_at,omitempty"`
+	Interests     []string  `json:"interests,omitempty"` // followed tags, nil leaves them alone
 }
 
 // UserProfile is a showcash profile
-// That can link to other profiles
+// That can link to other profiles - Friends and Followers only hold the
+// first few, the counts are the totals
 type UserProfile struct {
-	UserID      uuid.UUID     `json:"user_id,omitempty"`
-	Username    string        `json:"username,omitempty"`
-	RealName    string        `json:"realname,omitempty"`
-	Location    string        `json:"location,omitempty"`
-	ProfileURI  string        `json:"profile_uri,omitempty"`
-	Bio         string        `json:"bio,omitempty"`
-	Social1     string        `json:"social_1,omitempty"`
-	Social2     string        `json:"social_2,omitempty"`
-	Social3     string        `json:"social_3,omitempty"`
-	Friends     []UserProfile `json:"friends,omitempty"`
-	Followers   []UserProfile `json:"followers,omitempty"`
-	Interests   []string      `json:"interests,omitempty"`
-	MemberSince time.Time     `json:"created_at,omitempty"`
+	UserID         uuid.UUID     `json:"user_id,omitempty"`
+	Username       string        `json:"username,omitempty"`
+	RealName       string        `json:"realname,omitempty"`
+	Location       string        `json:"location,omitempty"`
+	ProfileURI     string        `json:"profile_uri,omitempty"`
+	Bio            string        `json:"bio,omitempty"`
+	Social1        string        `json:"social_1,omitempty"`
+	Social2        string        `json:"social_2,omitempty"`
+	Social3        string        `json:"social_3,omitempty"`
+	Social1URL     string        `json:"social_1_url,omitempty"`
+	Social2URL     string        `json:"social_2_url,omitempty"`
+	Social3URL     string        `json:"social_3_url,omitempty"`
+	Friends        []UserProfile `json:"friends,omitempty"` // people this user follows
+	Followers      []UserProfile `json:"followers,omitempty"`
+	FollowingCount int           `json:"following_count,omitempty"`
+	FollowerCount  int           `json:"follower_count,omitempty"`
+	Interests      []string      `json:"interests,omitempty"`
+	MemberSince    time.Time     `json:"created_at,omitempty"`
+}
+
+// Report is a user flagging a post, comment or profile
+type Report struct {
+	ID         uuid.UUID `json:"id,omitempty"`
+	ReporterID uuid.UUID `json:"reporter_id,omitempty"`
+	TargetType string    `json:"target_type"`
+	TargetID   uuid.UUID `json:"target_id"`
+	Reason     string    `json:"reason"`
+	CreatedAt  time.Time `json:"created_at,omitempty"`
+}
+
+// ReportSummary groups every report made against a single target
+// for the moderators
+type ReportSummary struct {
+	TargetType   string         `json:"target_type"`
+	TargetID     uuid.UUID      `json:"target_id"`
+	Reports      int            `json:"reports"`
+	Reasons      pq.StringArray `json:"reasons"`
+	Hidden       bool           `json:"hidden"`
+	LastReported time.Time      `json:"last_reported"`
+}
+
+// FeedPage is a page of a user's home feed. Pass NextCursor back as
+// ?cursor= to get the next page, it's empty when there are no more.
+type FeedPage struct {
+	Posts      []Post `json:"posts"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	Trending   bool   `json:"trending,omitempty"` // nobody followed yet so here's what's hot
+}
+
+// AccountJob tracks a slow job run against a whole account, like deleting it
+type AccountJob struct {
+	ID         uuid.UUID  `json:"id"`
+	UserID     uuid.UUID  `json:"user_id"`
+	Kind       string     `json:"kind"`
+	Status     string     `json:"status"` // pending, running, done or failed
+	Error      string     `json:"error,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// AccountExport is everything we hold about a user
+type AccountExport struct {
+	ExportedAt time.Time   `json:"exported_at"`
+	User       User        `json:"user"`
+	Profile    UserProfile `json:"profile"`
+	Posts      []Post      `json:"posts"`
+	Comments   []Comment   `json:"comments"`
+	Images     []string    `json:"images"`
+}
+
+// LoginAttempt is one try at /auth/login
+type LoginAttempt struct {
+	Login     string     `json:"login"`
+	IP        string     `json:"ip"`
+	UserAgent string     `json:"user_agent"`
+	UserID    *uuid.UUID `json:"user_id"`
+	Outcome   string     `json:"outcome"` // ok, bad_creds, throttled or 2fa_pending
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// APIToken is a personal token for scripts, the secret is only ever
+// shown when it is made
+type APIToken struct {
+	ID         uuid.UUID      `json:"id"`
+	UserID     uuid.UUID      `json:"user_id"`
+	Name       string         `json:"name"`
+	Prefix     string         `json:"prefix"`
+	Scopes     pq.StringArray `json:"scopes"`
+	CreatedAt  time.Time      `json:"created_at"`
+	LastUsedAt *time.Time     `json:"last_used_at,omitempty"`
+	Token      string         `json:"token,omitempty"`
 }
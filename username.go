@@ -0,0 +1,85 @@
+package showcash
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+)
+
+const (
+	// usernameCooldown is how long you have to wait between handle changes
+	usernameCooldown = 30 * 24 * time.Hour
+	// usernameReservation is how long an old handle keeps redirecting to
+	// its owner before anyone else can take it
+	usernameReservation = 90 * 24 * time.Hour
+)
+
+var (
+	errUsernameTaken    = errors.New("username is taken")
+	errUsernameCooldown = errors.New("username changed too recently")
+)
+
+func (c *Core) apiPutUsername(wr http.ResponseWriter, req *http.Request) {
+	u := GetSessionFromContext(req)
+	if u == nil {
+		apiUnauthorizedError.write(wr)
+		return
+	}
+
+	payload := struct {
+		Username string `json:"username"`
+	}{}
+	if err := json.NewDecoder(req.Body).Decode(&payload); err != nil {
+		log.Println("apiPutUsername.Decode() failed", err)
+		apiBadJSONError.write(wr)
+		return
+	}
+
+	if err := validateUsername(payload.Username); err != nil {
+		validationResponse(wr, err)
+		return
+	}
+
+	err := c.dao.changeUsername(u.UserID, payload.Username, usernameCooldown, usernameReservation)
+	switch {
+	case errors.Is(err, errUsernameTaken):
+		apiConflictError.withCode("username_taken").withMessage("That username is taken").write(wr)
+		return
+	case errors.Is(err, errUsernameCooldown):
+		apiTooManyRequestsError.withMessage("You can only change your username every 30 days").write(wr)
+		return
+	case err != nil:
+		log.Println("apiPutUsername().changeUsername failed", err)
+		apiServerError.write(wr)
+		return
+	}
+
+	// The cookie carries the username so swap it for a fresh one
+	u.Username = payload.Username
+	setUserCookie(wr, *u)
+	log.Println(u.UserID, "is now", u.Username)
+
+	profile, _ := c.dao.getUserProfileByID(u.UserID)
+	if err := json.NewEncoder(wr).Encode(profile); err != nil {
+		log.Printf("Error Encoding JSON: %s", err)
+	}
+}
+
+// redirectOldHandle sends requests for a recently changed handle to the
+// new one, returning false if handle was never anyone's. The redirect is
+// temporary as the handle goes back up for grabs once its reservation is
+// over, and a cached 301 would keep sending people to the old owner.
+func (c *Core) redirectOldHandle(wr http.ResponseWriter, req *http.Request, handle string) bool {
+	current, err := c.dao.getCurrentUsername(handle)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Println("redirectOldHandle().getCurrentUsername failed", err)
+		}
+		return false
+	}
+	http.Redirect(wr, req, "/api/profile/"+current, http.StatusFound)
+	return true
+}
@@ -0,0 +1,99 @@
+package showcash
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestCore_HandlerUsernameChange(t *testing.T) {
+	store, srv, nick := newTestServer(t)
+	defer srv.Close()
+	other := newLoggedInClient(t, srv, newTestUser(t, store, "Kim"))
+
+	profile := UserProfile{}
+	if got := nick.do(http.MethodPut, "/api/profile/username", map[string]string{"username": "Nicky"}, &profile); got != http.StatusOK || profile.Username != "Nicky" {
+		t.Fatalf("changing username = %d %+v", got, profile)
+	}
+	if got := nick.do(http.MethodGet, "/api/profile", nil, &profile); got != http.StatusOK || profile.Username != "Nicky" {
+		t.Errorf("profile after the change = %d %+v", got, profile)
+	}
+	if got := nick.do(http.MethodPut, "/api/profile/username", map[string]string{"username": "Nico"}, nil); got != http.StatusTooManyRequests {
+		t.Errorf("changing again straight away = %d, want %d", got, http.StatusTooManyRequests)
+	}
+
+	// The old handle is held for its owner
+	if got := other.do(http.MethodPut, "/api/profile/username", map[string]string{"username": "nick"}, nil); got != http.StatusConflict {
+		t.Errorf("taking a reserved handle = %d, want %d", got, http.StatusConflict)
+	}
+	if got := newAPIClient(t, srv).do(http.MethodPost, "/auth/register", User{Username: "Nick", EmailAddress: "new@example.com", Password: testPassword}, nil); got != http.StatusConflict {
+		t.Errorf("registering a reserved handle = %d, want %d", got, http.StatusConflict)
+	}
+	if got := other.do(http.MethodPut, "/api/profile/username", map[string]string{"username": "Nicky"}, nil); got != http.StatusConflict {
+		t.Errorf("taking a handle in use = %d, want %d", got, http.StatusConflict)
+	}
+
+	// ...and redirects to the new one, but not forever
+	noFollow := &http.Client{
+		Transport: srv.Client().Transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	resp, err := noFollow.Get(srv.URL + "/api/profile/Nick")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound || resp.Header.Get("Location") != "/api/profile/Nicky" {
+		t.Errorf("old handle = %d to %q, want %d to /api/profile/Nicky", resp.StatusCode, resp.Header.Get("Location"), http.StatusFound)
+	}
+	if got := nick.do(http.MethodGet, "/api/profile/Nick", nil, &profile); got != http.StatusOK || profile.Username != "Nicky" {
+		t.Errorf("following the old handle = %d %+v", got, profile)
+	}
+}
+
+func TestMemStore_changeUsername(t *testing.T) {
+	store := NewMemStore()
+	nick := newTestUser(t, store, "Nick")
+	kim := newTestUser(t, store, "Kim")
+
+	if err := store.changeUsername(nick.UserID, "Nicky", time.Hour, time.Hour); err != nil {
+		t.Fatal("first change failed", err)
+	}
+	if err := store.changeUsername(nick.UserID, "Nico", time.Hour, time.Hour); !errors.Is(err, errUsernameCooldown) {
+		t.Errorf("change inside the cooldown got %v, want %v", err, errUsernameCooldown)
+	}
+	if err := store.changeUsername(kim.UserID, "NICK", 0, time.Hour); !errors.Is(err, errUsernameTaken) {
+		t.Errorf("taking a reserved handle got %v, want %v", err, errUsernameTaken)
+	}
+	if err := store.changeUsername(kim.UserID, "nicky", 0, time.Hour); !errors.Is(err, errUsernameTaken) {
+		t.Errorf("taking a handle in use got %v, want %v", err, errUsernameTaken)
+	}
+	for _, old := range []string{"Nick", "nick"} {
+		if got, err := store.getCurrentUsername(old); err != nil || got != "Nicky" {
+			t.Errorf("getCurrentUsername(%s) = %q, %v", old, got, err)
+		}
+	}
+
+	// The owner can always go back
+	if err := store.changeUsername(nick.UserID, "Nick", 0, -time.Second); err != nil {
+		t.Errorf("going back to the old handle got %v", err)
+	}
+	if _, err := store.getCurrentUsername("Nick"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("a handle in use still redirects, err %v", err)
+	}
+
+	// Once the reservation is over the handle is anyone's
+	if _, err := store.getCurrentUsername("Nicky"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("an expired reservation still redirects, err %v", err)
+	}
+	if store.isUsernameReserved("Nicky") {
+		t.Error("an expired reservation is still reserved")
+	}
+	if err := store.changeUsername(kim.UserID, "Nicky", 0, time.Hour); err != nil {
+		t.Errorf("taking an expired handle got %v", err)
+	}
+}
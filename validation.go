@@ -0,0 +1,198 @@
+package showcash
+
+import (
+	"fmt"
+	"net/mail"
+	"strings"
+	"unicode/utf8"
+)
+
+// Maximum lengths (in characters) of user authored fields
+const (
+	maxTitle       = 140
+	maxDescription = 1000
+	maxLink        = 2048
+	maxComment     = 2000
+	maxRealName    = 64
+	maxLocation    = 100
+	maxBio         = 500
+	maxSocial      = 100
+	maxUsername    = 16
+	minPassword    = 8
+	maxPassword    = 128
+)
+
+// FieldError is a problem with a single field in a request
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// fieldErrors collects every FieldError for a request so the user can fix
+// them all in one go
+type fieldErrors []FieldError
+
+func (fe fieldErrors) Error() string {
+	msgs := make([]string, len(fe))
+	for i := range fe {
+		msgs[i] = fe[i].Field + ": " + fe[i].Message
+	}
+	return strings.Join(msgs, ", ")
+}
+
+func (fe *fieldErrors) add(field, message string) {
+	*fe = append(*fe, FieldError{Field: field, Message: message})
+}
+
+// text checks a free text field is within max characters and passes the
+// content filter
+func (fe *fieldErrors) text(field, value string, max int) {
+	if !fe.length(field, value, max) {
+		return
+	}
+	if hit, blocked := contentFilter.Check(value); blocked {
+		fe.add(field, "contains "+string(hit.Rule.Category)+" content")
+	}
+}
+
+// length checks value is valid UTF-8 and no longer than max, returning
+// false if it isn't
+func (fe *fieldErrors) length(field, value string, max int) bool {
+	if !utf8.ValidString(value) {
+		fe.add(field, "must be valid text")
+		return false
+	}
+	if utf8.RuneCountInString(value) > max {
+		fe.add(field, fmt.Sprintf("must be %d characters or less", max))
+		return false
+	}
+	return true
+}
+
+// required is text() for fields that can't be blank
+func (fe *fieldErrors) required(field, value string, max int) {
+	if strings.TrimSpace(value) == "" {
+		fe.add(field, "is required")
+		return
+	}
+	fe.text(field, value, max)
+}
+
+// err returns nil when there were no problems so callers can use the
+// usual err != nil check
+func (fe fieldErrors) err() error {
+	if len(fe) == 0 {
+		return nil
+	}
+	return fe
+}
+
+func validatePost(p Post) error {
+	fe := fieldErrors{}
+	fe.text("title", p.Title, maxTitle)
+	for i := range p.ItemList {
+		prefix := fmt.Sprintf("itemList[%d].", i)
+		fe.text(prefix+"title", p.ItemList[i].Title, maxTitle)
+		fe.text(prefix+"description", p.ItemList[i].Description, maxDescription)
+		fe.link(prefix+"link", p.ItemList[i].Link)
+	}
+	return fe.err()
+}
+
+func validateComment(c Comment) error {
+	fe := fieldErrors{}
+	fe.required("comment", c.Comment, maxComment)
+	return fe.err()
+}
+
+func validateReport(r Report) error {
+	fe := fieldErrors{}
+	if _, ok := reportTargets[r.TargetType]; !ok {
+		fe.add("target_type", "must be post, comment or user")
+	}
+	// Reasons often quote the offending content, so they skip the filter
+	if strings.TrimSpace(r.Reason) == "" {
+		fe.add("reason", "is required")
+	} else if utf8.RuneCountInString(r.Reason) > maxReportReason {
+		fe.add("reason", fmt.Sprintf("must be %d characters or less", maxReportReason))
+	}
+	return fe.err()
+}
+
+// validateProfile checks the fields a user can edit on their profile
+func validateProfile(u User) error {
+	fe := fieldErrors{}
+	fe.profile(u)
+	return fe.err()
+}
+
+func validateUsername(username string) error {
+	fe := fieldErrors{}
+	fe.username(username)
+	return fe.err()
+}
+
+func validatePassword(password string) error {
+	fe := fieldErrors{}
+	if n := utf8.RuneCountInString(password); n < minPassword || n > maxPassword {
+		fe.add("password", fmt.Sprintf("must be %d to %d characters", minPassword, maxPassword))
+	}
+	return fe.err()
+}
+
+func validateEmail(email string) error {
+	fe := fieldErrors{}
+	fe.email(email)
+	return fe.err()
+}
+
+// validateSignup is validateProfile plus the fields only set at signup
+func validateSignup(u User) error {
+	fe := fieldErrors{}
+	fe.username(u.Username)
+	fe.email(u.EmailAddress)
+	fe.profile(u)
+	return fe.err()
+}
+
+func (fe *fieldErrors) username(username string) {
+	if !isAlphaNumeric(username) || len(username) > maxUsername {
+		fe.add("username", fmt.Sprintf("must be 2 to %d letters, numbers, - or _", maxUsername))
+		return
+	}
+	fe.text("username", username, maxUsername)
+}
+
+func (fe *fieldErrors) email(email string) {
+	if addr, err := mail.ParseAddress(email); err != nil || addr.Address != email {
+		fe.add("email_address", "must be a valid email address")
+	}
+}
+
+func (fe *fieldErrors) profile(u User) {
+	fe.text("realname", u.RealName, maxRealName)
+	fe.text("location", u.Location, maxLocation)
+	fe.text("bio", u.Bio, maxBio)
+	for i, social := range []string{u.Social1, u.Social2, u.Social3} {
+		field := fmt.Sprintf("social_%d", i+1)
+		before := len(*fe)
+		if fe.text(field, social, maxSocial); len(*fe) > before {
+			continue
+		}
+		if _, err := canonicalSocial(i, social, false); err != nil {
+			fe.add(field, err.Error())
+		}
+	}
+}
+
+// link checks a link is safe to show to other people. Only the domain is
+// filtered, a path or query is opaque and the word list would catch slugs
+// and IDs that just happen to spell something.
+func (fe *fieldErrors) link(field, value string) {
+	if !fe.length(field, value, maxLink) {
+		return
+	}
+	if _, err := canonicalLink(value, false); err != nil {
+		fe.add(field, err.Error())
+	}
+}
@@ -0,0 +1,39 @@
+package showcash
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_validatePost(t *testing.T) {
+	p := Post{
+		Title: "My desk",
+		ItemList: []Item{
+			{Title: "Monitor", Description: "Big", Link: "https://example.com"},
+			{Title: "n1gg3r", Description: strings.Repeat("x", maxDescription+1)},
+			{Title: "Lamp", Link: "https://example.com/n1gg3r-lamp?ref=abc"},
+			{Title: "Chair", Link: "javascript:alert(1)"},
+			{Title: "Rug", Link: "https://pinkspornlist.com/rugs"},
+		},
+	}
+
+	err := validatePost(p)
+	fe := fieldErrors{}
+	if !errors.As(err, &fe) {
+		t.Fatalf("validatePost() = %v, want fieldErrors", err)
+	}
+	var got []string
+	for i := range fe {
+		got = append(got, fe[i].Field)
+	}
+	want := []string{"itemList[1].title", "itemList[1].description", "itemList[3].link", "itemList[4].link"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("validatePost() fields = %v, want %v", got, want)
+	}
+
+	if err := validatePost(Post{Title: "All good"}); err != nil {
+		t.Errorf("validatePost() = %v, want nil", err)
+	}
+}
@@ -0,0 +1,103 @@
+package showcash
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+// verifyEmailTTL is how long the link in a verification email works for
+const verifyEmailTTL = 48 * time.Hour
+
+// sendVerification emails the user a link to prove they own email
+func (c *Core) sendVerification(userID uuid.UUID, username, email string) error {
+	token, err := c.issueToken(userID, tokenVerifyEmail, email, verifyEmailTTL)
+	if err != nil {
+		return err
+	}
+	link := fmt.Sprintf("%s/verify?token=%s", c.siteURL, url.QueryEscape(token))
+	return c.mailer.Send(email, "Verify your Showcash email", fmt.Sprintf(
+		"Hi %s,\n\nClick the link below to verify your email address:\n\n%s\n\n"+
+			"The link works for %d hours. If you didn't sign up to Showcash you can ignore this email.\n",
+		username, link, int(verifyEmailTTL.Hours()),
+	))
+}
+
+func (c *Core) apiPostVerify(wr http.ResponseWriter, req *http.Request) {
+	payload := struct {
+		Token string `json:"token"`
+	}{}
+	if err := json.NewDecoder(req.Body).Decode(&payload); err != nil {
+		log.Println("apiPostVerify.Decode() failed", err)
+		apiBadJSONError.write(wr)
+		return
+	}
+
+	// The same link works for new accounts and changed email addresses
+	if ut, err := c.redeemToken(payload.Token, tokenVerifyEmail); err == nil {
+		if err := c.dao.setEmailVerified(ut.UserID, ut.EmailAddress); err != nil {
+			log.Println("apiPostVerify().setEmailVerified failed", err)
+			apiExpiredLinkError.write(wr)
+			return
+		}
+		apiOK.write(wr)
+		return
+	}
+
+	ut, err := c.redeemToken(payload.Token, tokenChangeEmail)
+	if err != nil {
+		apiExpiredLinkError.write(wr)
+		return
+	}
+	if err := c.dao.changeEmail(ut.UserID, ut.EmailAddress); pgErrIs(err, errNotUnique) {
+		apiConflictError.withCode("email_taken").withMessage("That email address already has an account").write(wr)
+		return
+	} else if err != nil {
+		log.Println("apiPostVerify().changeEmail failed", err)
+		apiServerError.write(wr)
+		return
+	}
+	apiOK.write(wr)
+}
+
+func (c *Core) apiPostResendVerify(wr http.ResponseWriter, req *http.Request) {
+	u := GetSessionFromContext(req)
+	if u == nil {
+		apiUnauthorizedError.write(wr)
+		return
+	}
+	if c.dao.isEmailVerified(u.UserID) {
+		apiOK.withMessage("Already verified").write(wr)
+		return
+	}
+	email, err := c.dao.getEmailAddress(u.UserID)
+	if err != nil {
+		log.Println("apiPostResendVerify().getEmailAddress failed", err)
+		apiServerError.write(wr)
+		return
+	}
+	if err := c.sendVerification(u.UserID, u.Username, email); err != nil {
+		log.Println("apiPostResendVerify().sendVerification failed", err)
+		apiServerError.write(wr)
+		return
+	}
+	apiOK.write(wr)
+}
+
+// verifiedMiddleware only lets users with a verified email through
+// Use it inside authMiddleware
+func (c *Core) verifiedMiddleware(h http.HandlerFunc) http.HandlerFunc {
+	return func(wr http.ResponseWriter, req *http.Request) {
+		u := GetSessionFromContext(req)
+		if u == nil || !c.dao.isEmailVerified(u.UserID) {
+			apiForbiddenError.withCode("email_unverified").withMessage("Verify your email address first").write(wr)
+			return
+		}
+		h.ServeHTTP(wr, req)
+	}
+}
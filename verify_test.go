@@ -0,0 +1,83 @@
+package showcash
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCore_verifiedMiddleware(t *testing.T) {
+	store := NewMemStore()
+	c := New(store)
+	h := c.verifiedMiddleware(func(wr http.ResponseWriter, req *http.Request) {
+		wr.WriteHeader(http.StatusOK)
+	})
+	unverified := newTestUser(t, store, "Nick")
+	verified := newTestUser(t, store, "Kim")
+	if err := store.setEmailVerified(verified.UserID, verified.EmailAddress); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		user *User
+		want int
+	}{
+		{"verified", &verified, http.StatusOK},
+		{"unverified", &unverified, http.StatusForbidden},
+		{"no session", nil, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/me", nil)
+			if tt.user != nil {
+				req = RequestWithUserSession(req, *tt.user)
+			}
+			rec := httptest.NewRecorder()
+			h(rec, req)
+			if rec.Code != tt.want {
+				t.Fatalf("got %d, want %d", rec.Code, tt.want)
+			}
+			if tt.want == http.StatusOK {
+				return
+			}
+			got := apiSimpleResponse{}
+			if err := json.NewDecoder(rec.Body).Decode(&got); err != nil || got.Code != "email_unverified" || got.Message == "" {
+				t.Errorf("body = %+v %v, want code email_unverified", got, err)
+			}
+		})
+	}
+}
+
+func TestCore_HandlerVerifyEmail(t *testing.T) {
+	store := NewMemStore()
+	mail := &testMailer{}
+	srv := httptest.NewServer(New(store, WithMailer(mail)).Handler())
+	defer srv.Close()
+	// Signing up is what sends the first link
+	nick := newAPIClient(t, srv)
+	if got := nick.do(http.MethodPost, "/auth/register", User{Username: "Nick", EmailAddress: "nick@example.com", Password: testPassword}, nil); got != http.StatusOK {
+		t.Fatalf("register = %d", got)
+	}
+
+	failed := apiSimpleResponse{}
+	if got := nick.do(http.MethodPost, "/api/comments/8b1c5e3e-9d2f-4c7a-a0b1-2f3e4d5c6b7a", Comment{Comment: "hi"}, &failed); got != http.StatusForbidden || failed.Code != "email_unverified" {
+		t.Errorf("commenting before verifying = %d %+v", got, failed)
+	}
+
+	token := mail.token("nick@example.com")
+	if token == "" {
+		t.Fatal("no verification email")
+	}
+	if got := nick.do(http.MethodPost, "/auth/verify", map[string]string{"token": token}, nil); got != http.StatusOK {
+		t.Fatalf("verifying = %d", got)
+	}
+	userID, _ := store.getUserIDByHandle("Nick")
+	if !store.isEmailVerified(userID) {
+		t.Error("email isn't verified after following the link")
+	}
+	if got := nick.do(http.MethodPost, "/auth/verify", map[string]string{"token": token}, &failed); got != http.StatusBadRequest || failed.Code != "expired" {
+		t.Errorf("using the link twice = %d %+v", got, failed)
+	}
+}